@@ -3,79 +3,166 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/go-playground/validator/v10"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgx/v5/stdlib"
+	"gopkg.in/yaml.v3"
+	"io"
 	"log/slog"
 	"net/http"
-	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/app"
+	"order-event-processor/internal/clock"
 	"order-event-processor/internal/config"
-	"order-event-processor/internal/handler"
-	"order-event-processor/internal/storage/postgresql"
+	"order-event-processor/internal/datasource"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/tracing"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	cfg := config.ReadConfig("./config/local.yaml")
-	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
-	validate := validator.New()
+	var source config.Source
+	source.RegisterFlags(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Parse()
 
-	dbpool, err := pgxpool.New(context.Background(), cfg.Datasource.Url)
+	cfg, err := config.Load(source)
 	if err != nil {
-		log.Error("unable to create connection pool", "error", err)
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
-	defer dbpool.Close()
+	if *printConfig {
+		if err := writeConfig(os.Stdout, cfg.Redacted()); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to print config: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	driver, err := postgres.WithInstance(stdlib.OpenDBFromPool(dbpool), &postgres.Config{})
+	logLevel := new(slog.LevelVar)
+	log, err := newLogger(cfg.Log, logLevel)
 	if err != nil {
-		log.Error("unable to acquire database driver", "error", err)
+		fmt.Fprintf(os.Stderr, "invalid log config: %s\n", err)
 		os.Exit(1)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
-		"postgres", driver)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Error("unable to set up migrations", "error", err)
+		log.Error("unable to set up tracing", "exporter", cfg.Tracing.Exporter, "error", err)
 		os.Exit(1)
 	}
 
-	err = m.Up()
-	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		log.Error("unable to apply migrations", "error", err)
+	storage, checkMigrations, closeStorage, err := datasource.Open(log, cfg.Datasource)
+	if err != nil {
+		log.Error("unable to set up storage", "driver", cfg.Datasource.Driver, "error", err)
 		os.Exit(1)
 	}
-	log.Info("migration completed successfully")
-
-	storage := postgresql.New(dbpool)
+	defer closeStorage()
 
-	router := http.NewServeMux()
-	producer := broadcaster.NewFromDbEventProducer(storage)
-	orderEventBroadcaster := broadcaster.NewOrderEventBroadcaster(producer)
-	producer.OrderEventBroadcaster = orderEventBroadcaster
-	paymentSystemEventHandler := handler.NewPaymentSystemEventHandler(log, validate, storage, orderEventBroadcaster)
-	orderEventStreamHandler := handler.NewOrderEventStreamHandler(log, orderEventBroadcaster)
-	ordersHandler := handler.NewOrdersHandler(log, storage)
-
-	router.HandleFunc("POST /webhooks/payments/orders", paymentSystemEventHandler.Handle)
-	router.HandleFunc("GET /orders/{order_id}/events", orderEventStreamHandler.StreamOrderEvents)
-	router.HandleFunc("GET /orders", ordersHandler.GetAllOrders)
+	application := app.New(log, cfg, storage, clock.Real{})
+	application.UseLogLevel(logLevel)
+	if checkMigrations != nil {
+		application.AddReadinessCheck("migrations", checkMigrations)
+	}
+	application.StartBackgroundJobs()
 
 	server := http.Server{
 		Addr:    fmt.Sprintf("%s:%s", cfg.HTTPServer.Host, cfg.HTTPServer.Port),
-		Handler: router,
+		Handler: application.Handler(),
 	}
+	// streams never become idle on their own, they would hold Shutdown until the deadline
+	server.RegisterOnShutdown(application.CloseStreams)
 
-	log.Info("starting server", "host", cfg.HTTPServer.Host, "port", cfg.HTTPServer.Port)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go reloadConfig(ctx, source, application)
 
-	err = server.ListenAndServe()
-	if err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info("starting server", "host", cfg.HTTPServer.Host, "port", cfg.HTTPServer.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	failed := false
+	select {
+	case err := <-serverErr:
+		// background jobs and the pool are already running, they are stopped below like on a signal
 		log.Error("failed to start server", "error", err)
-		return
+		failed = true
+	case <-ctx.Done():
+	}
+
+	log.Info("shutting down", "timeout", cfg.HTTPServer.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	// in-flight webhooks finish their transactions before Shutdown returns, chinazes jobs they started are awaited below
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("failed to drain requests", "error", err)
+	}
+	if err := application.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to drain background jobs", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Error("failed to flush traces", "error", err)
+	}
+	log.Info("server stopped")
+	if failed {
+		// os.Exit skips the deferred calls, a non-zero status lets supervisors restart the server
+		cancel()
+		closeStorage()
+		os.Exit(1)
+	}
+}
+
+func writeConfig(w io.Writer, cfg config.Config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// newLogger sets level from cfg, the level can be changed later by config reloads.
+func newLogger(cfg config.Log, level *slog.LevelVar) (*slog.Logger, error) {
+	parsed, err := logger.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	level.Set(parsed)
+	return logger.New(os.Stdout, cfg.Format, level)
+}
+
+// configWatchInterval is how often config files are checked for changes.
+const configWatchInterval = 5 * time.Second
+
+// reloadConfig reloads the config on SIGHUP and when its files change, until ctx is done.
+func reloadConfig(ctx context.Context, source config.Source, application *app.App) {
+	// the files were read on start, so the source is valid
+	files, _ := source.Files()
+	changed := make(chan struct{}, 1)
+	go config.Watch(ctx, files, configWatchInterval, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		case <-changed:
+		}
+		application.Reload(func() (*config.Config, error) {
+			return config.Load(source)
+		})
 	}
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/stats"
+	"order-event-processor/test/scenario"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type options struct {
+	url         string
+	orders      int
+	workers     int
+	subscribers int
+	outOfOrder  float64
+	duplicates  float64
+	drain       time.Duration
+	seed        int64
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.url, "url", "http://localhost:8080", "base URL of the server")
+	flag.IntVar(&opts.orders, "orders", 1000, "order lifecycles to send")
+	flag.IntVar(&opts.workers, "workers", 16, "orders sent at the same time, events of one order are sent one by one")
+	flag.IntVar(&opts.subscribers, "subscribers", 100, "SSE clients, spread over the first orders")
+	flag.Float64Var(&opts.outOfOrder, "out-of-order", 0.3, "share of orders whose events are sent shuffled")
+	flag.Float64Var(&opts.duplicates, "duplicates", 0.1, "probability that an event is sent twice")
+	flag.DurationVar(&opts.drain, "drain", 10*time.Second, "how long subscribers wait for events after the last webhook")
+	flag.Int64Var(&opts.seed, "seed", time.Now().UnixNano(), "seed of generated lifecycles")
+	flag.Parse()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	target := scenario.Target{URL: strings.TrimSuffix(opts.url, "/")}
+
+	orders := generateOrders(rand.New(rand.NewSource(opts.seed)), opts)
+	log.Info("generated orders", "orders", len(orders), "seed", opts.seed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribers, err := subscribe(ctx, target, orders, opts.subscribers)
+	if err != nil {
+		log.Error("unable to subscribe", "error", err)
+		os.Exit(1)
+	}
+	log.Info("subscribed", "subscribers", len(subscribers))
+
+	started := time.Now()
+	sent := send(target, orders, opts.workers)
+	elapsed := time.Since(started)
+
+	drained := time.After(opts.drain)
+	for _, s := range subscribers {
+		select {
+		case <-s.done:
+		case <-drained:
+		}
+	}
+	cancel()
+
+	report(sent, subscribers, elapsed)
+}
+
+type order struct {
+	id         string
+	deliveries []model.OrderEvent
+}
+
+// generateOrders builds lifecycles with unique ids, out of order lifecycles are shuffled
+// and duplicates are sent again later in the same lifecycle.
+func generateOrders(random *rand.Rand, opts options) []order {
+	orders := make([]order, 0, opts.orders)
+	for i := 0; i < opts.orders; i++ {
+		orderId := uuid.NewString()
+		lifecycle := scenario.GenerateLifecycle(random, orderId, time.Now().UTC())
+		deliveries := make([]model.OrderEvent, 0, len(lifecycle))
+		for _, event := range lifecycle {
+			event.EventID = uuid.NewString()
+			deliveries = append(deliveries, event)
+		}
+		if random.Float64() < opts.outOfOrder {
+			random.Shuffle(len(deliveries), func(i, j int) {
+				deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+			})
+		}
+		for i := len(deliveries) - 1; i >= 0; i-- {
+			if random.Float64() < opts.duplicates {
+				at := i + 1 + random.Intn(len(deliveries)-i)
+				deliveries = append(deliveries[:at], append([]model.OrderEvent{deliveries[i]}, deliveries[at:]...)...)
+			}
+		}
+		orders = append(orders, order{id: orderId, deliveries: deliveries})
+	}
+	return orders
+}
+
+type sendResult struct {
+	latencies  []time.Duration
+	statuses   map[int]int
+	errors     int
+	firstSent  map[string]time.Time
+	eventCount int
+}
+
+func send(target scenario.Target, orders []order, workers int) sendResult {
+	result := sendResult{statuses: make(map[int]int), firstSent: make(map[string]time.Time)}
+	var mutex sync.Mutex
+	jobs := make(chan order)
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range jobs {
+				for _, event := range o.deliveries {
+					sentAt := time.Now()
+					status, err := scenario.Post(target, scenario.Payload(event))
+					latency := time.Since(sentAt)
+
+					mutex.Lock()
+					result.eventCount++
+					if _, ok := result.firstSent[event.EventID]; !ok {
+						result.firstSent[event.EventID] = sentAt
+					}
+					if err != nil {
+						result.errors++
+					} else {
+						result.statuses[status]++
+						result.latencies = append(result.latencies, latency)
+					}
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for _, o := range orders {
+		jobs <- o
+	}
+	close(jobs)
+	wg.Wait()
+	return result
+}
+
+func report(sent sendResult, subscribers []*subscriber, elapsed time.Duration) {
+	fmt.Printf("webhooks: %d in %s, %.1f/s, errors: %d\n",
+		sent.eventCount, elapsed.Round(time.Millisecond), float64(sent.eventCount)/elapsed.Seconds(), sent.errors)
+	for _, status := range []int{http.StatusOK, http.StatusConflict, http.StatusGone} {
+		fmt.Printf("  status %d: %d\n", status, sent.statuses[status])
+	}
+	for status, count := range sent.statuses {
+		if status != http.StatusOK && status != http.StatusConflict && status != http.StatusGone {
+			fmt.Printf("  status %d: %d\n", status, count)
+		}
+	}
+	printSummary("webhook latency", stats.Summarize(sent.latencies))
+
+	var lags []time.Duration
+	streamed := 0
+	for _, s := range subscribers {
+		for eventId, receivedAt := range s.firstReceived() {
+			streamed++
+			if sentAt, ok := sent.firstSent[eventId]; ok {
+				lags = append(lags, receivedAt.Sub(sentAt))
+			}
+		}
+	}
+	fmt.Printf("subscribers: %d, streamed events: %d\n", len(subscribers), streamed)
+	printSummary("delivery lag", stats.Summarize(lags))
+}
+
+func printSummary(name string, summary model.LatencySummary) {
+	fmt.Printf("%s: count %d, p50 %s, p90 %s, p95 %s, p99 %s, max %s\n", name, summary.Count,
+		seconds(summary.P50), seconds(summary.P90), seconds(summary.P95), seconds(summary.P99), seconds(summary.Max))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriber records when each event of an order was first streamed, a final event is streamed twice
+// for chinazes and only the first receipt counts.
+type subscriber struct {
+	mutex    sync.Mutex
+	received map[string]time.Time
+	done     chan struct{}
+}
+
+func subscribe(ctx context.Context, target scenario.Target, orders []order, count int) ([]*subscriber, error) {
+	subscribers := make([]*subscriber, 0, count)
+	for i := 0; i < count && len(orders) > 0; i++ {
+		s, err := connect(ctx, target, orders[i%len(orders)].id)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, nil
+}
+
+// connect returns once the server subscribed the stream.
+func connect(ctx context.Context, target scenario.Target, orderId string) (*subscriber, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/orders/%s/events", target.URL, orderId), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid stream response status %s", resp.Status)
+	}
+
+	s := &subscriber{received: make(map[string]time.Time), done: make(chan struct{})}
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(s.done)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == ": subscribed" {
+				close(subscribed)
+				continue
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			receivedAt := time.Now()
+			event := model.OrderEvent{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				continue
+			}
+			s.mutex.Lock()
+			if _, ok := s.received[event.EventID]; !ok {
+				s.received[event.EventID] = receivedAt
+			}
+			s.mutex.Unlock()
+		}
+	}()
+
+	select {
+	case <-subscribed:
+		return s, nil
+	case <-s.done:
+		return nil, fmt.Errorf("stream of order %s closed before it was subscribed", orderId)
+	case <-time.After(10 * time.Second):
+		return nil, fmt.Errorf("stream of order %s was not subscribed within 10s", orderId)
+	}
+}
+
+func (s *subscriber) firstReceived() map[string]time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	received := make(map[string]time.Time, len(s.received))
+	for eventId, receivedAt := range s.received {
+		received[eventId] = receivedAt
+	}
+	return received
+}
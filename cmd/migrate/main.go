@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/migration"
+	"order-event-processor/internal/storage/sqlite"
+	"os"
+	"strconv"
+)
+
+const usage = `usage: migrate [flags] <command>
+
+commands:
+  status     print the current and latest version and the pending migrations
+  up         apply every pending migration
+  down N     roll back the last N migrations
+  goto V     migrate up or down to version V
+  force V    record version V without running migrations and clear the dirty flag,
+             after repairing a failed migration by hand, -1 records no migration
+
+flags:
+`
+
+func main() {
+	var source config.Source
+	source.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level: %s\n", err)
+		os.Exit(1)
+	}
+	log, err := logger.New(os.Stderr, cfg.Log.Format, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log format: %s\n", err)
+		os.Exit(1)
+	}
+
+	db, err := openDB(cfg.Datasource)
+	if err != nil {
+		log.Error("unable to open database", "driver", cfg.Datasource.Driver, "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	migrator, err := migration.New(log, cfg.Datasource.Driver, db)
+	if err != nil {
+		log.Error("unable to set up migrations", "error", err)
+		os.Exit(1)
+	}
+
+	if err := run(migrator, flag.Args()); err != nil {
+		log.Error("migration failed", "command", flag.Arg(0), "error", err)
+		os.Exit(1)
+	}
+}
+
+func openDB(datasource config.Datasource) (*sql.DB, error) {
+	switch datasource.Driver {
+	case config.DriverPostgres:
+		db, err := sql.Open("pgx", datasource.Url)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	case config.DriverSqlite:
+		return sqlite.Open(datasource.Url)
+	default:
+		return nil, fmt.Errorf("%w: %s", migration.ErrNoMigrations, datasource.Driver)
+	}
+}
+
+func run(migrator *migration.Migrator, args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "status":
+		if err := expectArgs(command, args, 0); err != nil {
+			return err
+		}
+		return printStatus(migrator)
+	case "up":
+		if err := expectArgs(command, args, 0); err != nil {
+			return err
+		}
+		if err := migrator.Up(); err != nil {
+			return err
+		}
+	case "down":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		steps, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		if err := migrator.Down(steps); err != nil {
+			return err
+		}
+	case "goto":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		version, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := migrator.Goto(uint(version)); err != nil {
+			return err
+		}
+	case "force":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := migrator.Force(version); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command %q, run with -h for usage", command)
+	}
+	return printStatus(migrator)
+}
+
+func expectArgs(command string, args []string, count int) error {
+	if len(args) != count {
+		return fmt.Errorf("%s expects %d arguments but got %d", command, count, len(args))
+	}
+	return nil
+}
+
+func printStatus(migrator *migration.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version: %d, dirty: %t, latest: %d, pending: %v\n", status.Version, status.Dirty, status.Latest, status.Pending)
+	if status.Dirty {
+		return errors.New("database is dirty, repair the failed migration and run force")
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"order-event-processor/internal/model"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: orderctl [flags] <command> <args>
+
+commands:
+  show ORDER                 print the order with its in order and buffered events
+  reorder ORDER              recompute which events of the order are in order
+  finalize ORDER             make the last in order event final
+  transition ORDER STATUS    move the order to STATUS if the current status allows it
+  force-status ORDER STATUS  move the order to STATUS regardless of the allowed transitions
+  delete-event ORDER EVENT   delete a bogus event and reorder the remaining events
+  audit ORDER                print the manual changes made to the order
+  tail ORDER                 print events of the order as they are applied until the order is final
+
+commands changing an order need -reason, the change is recorded in the audit log with -operator,
+the admin token of the server is read from ORDERCTL_TOKEN
+
+flags:
+`
+
+// statusHints explain responses of the admin endpoints, the server answers errors without a body.
+var statusHints = map[int]string{
+	http.StatusBadRequest:   "invalid request",
+	http.StatusUnauthorized: "missing or wrong admin token, set ORDERCTL_TOKEN to the admin.token of the server",
+	http.StatusNotFound:     "order or event not found",
+	http.StatusConflict:     "order cannot be changed, it is final, has no in order events or the transition is not allowed",
+}
+
+type client struct {
+	server   string
+	token    string
+	operator string
+	reason   string
+	json     bool
+	http     *http.Client
+}
+
+func main() {
+	server := flag.String("server", envOr("ORDERCTL_SERVER", "http://localhost:8080"), "base URL of the server (ORDERCTL_SERVER)")
+	// read from the environment only, flags show up in the process list
+	token := os.Getenv("ORDERCTL_TOKEN")
+	operator := flag.String("operator", envOr("ORDERCTL_OPERATOR", os.Getenv("USER")), "operator recorded with changes (ORDERCTL_OPERATOR)")
+	reason := flag.String("reason", "", "why the order is changed, required by commands changing an order")
+	printJSON := flag.Bool("json", false, "print responses as JSON")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of requests, tail is not limited")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		server:   strings.TrimSuffix(*server, "/"),
+		token:    token,
+		operator: *operator,
+		reason:   *reason,
+		json:     *printJSON,
+		http:     &http.Client{Timeout: *timeout},
+	}
+	if err := c.run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "orderctl %s: %s\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func (c *client) run(args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "show":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		return c.printTimeline(http.MethodGet, orderPath(args[0], "timeline"), nil)
+	case "reorder":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		return c.change(http.MethodPost, orderPath(args[0], "reorder"), nil)
+	case "finalize":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		return c.change(http.MethodPost, orderPath(args[0], "finalize"), nil)
+	case "transition", "force-status":
+		if err := expectArgs(command, args, 2); err != nil {
+			return err
+		}
+		return c.change(http.MethodPost, orderPath(args[0], "transitions"), map[string]any{"status": args[1], "force": command == "force-status"})
+	case "delete-event":
+		if err := expectArgs(command, args, 2); err != nil {
+			return err
+		}
+		return c.change(http.MethodDelete, orderPath(args[0], "events", args[1]), nil)
+	case "audit":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		return c.printAuditLog(args[0])
+	case "tail":
+		if err := expectArgs(command, args, 1); err != nil {
+			return err
+		}
+		return c.tail(args[0])
+	default:
+		return fmt.Errorf("unknown command, run with -h for usage")
+	}
+}
+
+func expectArgs(command string, args []string, count int) error {
+	if len(args) != count {
+		return fmt.Errorf("%s expects %d arguments but got %d", command, count, len(args))
+	}
+	return nil
+}
+
+func orderPath(orderId string, elems ...string) string {
+	path := "/admin/orders/" + url.PathEscape(orderId)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
+
+// change sends fields together with the operator and the reason and prints the resulting timeline.
+func (c *client) change(method string, path string, fields map[string]any) error {
+	if c.operator == "" {
+		return fmt.Errorf("-operator is required")
+	} else if c.reason == "" {
+		return fmt.Errorf("-reason is required")
+	}
+	body := map[string]any{"operator_id": c.operator, "reason": c.reason}
+	for key, value := range fields {
+		body[key] = value
+	}
+	return c.printTimeline(method, path, body)
+}
+
+func (c *client) printTimeline(method string, path string, body any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	request, err := c.newRequest(method, path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := checkStatus(response); err != nil {
+		return err
+	}
+
+	if c.json {
+		_, err = io.Copy(os.Stdout, response.Body)
+		return err
+	}
+	var timeline model.OrderTimeline
+	if err := json.NewDecoder(response.Body).Decode(&timeline); err != nil {
+		return fmt.Errorf("decoding order timeline: %w", err)
+	}
+	return writeTimeline(os.Stdout, timeline)
+}
+
+// newRequest returns a request to path of the server carrying the admin token.
+func (c *client) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	return request, nil
+}
+
+func checkStatus(response *http.Response) error {
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+	if hint, ok := statusHints[response.StatusCode]; ok {
+		return fmt.Errorf("server answered %s: %s", response.Status, hint)
+	}
+	return fmt.Errorf("server answered %s", response.Status)
+}
+
+func writeTimeline(w io.Writer, timeline model.OrderTimeline) error {
+	status := string(timeline.Status)
+	if status == "" {
+		status = "none"
+	}
+	fmt.Fprintf(w, "order %s, status: %s, final: %t\n", timeline.OrderID, status, timeline.IsFinal)
+	for _, section := range []struct {
+		name   string
+		events []model.TimelineEvent
+	}{
+		{"in order", timeline.InOrder},
+		{"buffered", timeline.Buffered},
+	} {
+		fmt.Fprintf(w, "\n%s (%d):\n", section.name, len(section.events))
+		if len(section.events) == 0 {
+			continue
+		}
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "EVENT\tSTATUS\tFINAL\tUPDATED\tRECEIVED\tAPPLIED\tOPERATOR\tREASON")
+		for _, event := range section.events {
+			applied := "-"
+			if event.AppliedAt != nil {
+				applied = formatTime(*event.AppliedAt)
+			}
+			operator, reason := event.OperatorID, event.Reason
+			if operator == "" {
+				operator, reason = "-", "-"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%t\t%s\t%s\t%s\t%s\t%s\n", event.EventID, event.OrderStatus, event.IsFinal,
+				formatTime(event.UpdatedAt), formatTime(event.ReceivedAt), applied, operator, reason)
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (c *client) printAuditLog(orderId string) error {
+	request, err := c.newRequest(http.MethodGet, orderPath(orderId, "audit"), nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := checkStatus(response); err != nil {
+		return err
+	}
+
+	if c.json {
+		_, err = io.Copy(os.Stdout, response.Body)
+		return err
+	}
+	var entries []model.AuditEntry
+	if err := json.NewDecoder(response.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("decoding audit log: %w", err)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("order %s has no manual changes\n", orderId)
+		return nil
+	}
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CREATED\tACTION\tOPERATOR\tEVENT\tDETAILS\tREASON")
+	for _, entry := range entries {
+		eventId := entry.EventID
+		if eventId == "" {
+			eventId = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", formatTime(entry.CreatedAt), entry.Action, entry.OperatorID,
+			eventId, entry.Details, entry.Reason)
+	}
+	return table.Flush()
+}
+
+// tail follows the event stream of the order, the server ends it once the order is final or it shuts down.
+func (c *client) tail(orderId string) error {
+	response, err := http.Get(c.server + "/orders/" + url.PathEscape(orderId) + "/events")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := checkStatus(response); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	eventType := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && eventType == "shutdown":
+			return fmt.Errorf("stream closed, %s", strings.TrimPrefix(line, "data: "))
+		case strings.HasPrefix(line, "data: "):
+			data := strings.TrimPrefix(line, "data: ")
+			if c.json {
+				fmt.Println(data)
+				continue
+			}
+			var event model.OrderEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return fmt.Errorf("decoding event: %w", err)
+			}
+			fmt.Printf("%s  %s  %s\n", formatTime(event.UpdatedAt), event.EventID, event.OrderStatus)
+		case line == "":
+			eventType = ""
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/datasource"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/projection"
+	"os"
+)
+
+func main() {
+	var source config.Source
+	source.RegisterFlags(flag.CommandLine)
+	dryRun := flag.Bool("dry-run", false, "print differences without writing them")
+	batchSize := flag.Int("batch-size", 0, "orders per batch, overrides projection.batch_size")
+	workers := flag.Int("workers", 0, "batches processed in parallel, overrides projection.workers")
+	flag.Parse()
+
+	cfg, err := config.Load(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level: %s\n", err)
+		os.Exit(1)
+	}
+	log, err := logger.New(os.Stderr, cfg.Log.Format, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log format: %s\n", err)
+		os.Exit(1)
+	}
+	if *batchSize > 0 {
+		cfg.Projection.BatchSize = *batchSize
+	}
+	if *workers > 0 {
+		cfg.Projection.Workers = *workers
+	}
+
+	// run closes the storage before returning, os.Exit would skip its deferred calls
+	if err := run(log, cfg, *dryRun); err != nil {
+		log.Error("unable to rebuild projections", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(log *slog.Logger, cfg *config.Config, dryRun bool) error {
+	storage, checkMigrations, closeStorage, err := datasource.Open(log, cfg.Datasource)
+	if err != nil {
+		return fmt.Errorf("unable to set up %s storage: %w", cfg.Datasource.Driver, err)
+	}
+	defer closeStorage()
+
+	ctx := context.Background()
+	// with auto migration disabled the schema may be behind, rebuilding against it would fail half way
+	if checkMigrations != nil {
+		if err := checkMigrations(ctx); err != nil {
+			return err
+		}
+	}
+
+	rebuilder := projection.NewRebuilder(log, storage, cfg.Projection.BatchSize, cfg.Projection.Workers, clock.Real{})
+	report, err := rebuilder.Rebuild(ctx, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, diff := range report.Diffs {
+		fmt.Print(diff)
+	}
+	fmt.Printf("dry run: %t, orders scanned: %d, orders changed: %d, orders failed: %d\n",
+		report.DryRun, report.OrdersScanned, report.OrdersChanged, len(report.Failed))
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d orders failed", len(report.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(path string, results []*result, elapsed time.Duration) error {
+	suite := junitTestSuite{Name: "scenarios", Tests: len(results), Time: elapsed.Seconds()}
+	for _, r := range results {
+		testCase := junitTestCase{Name: r.name, ClassName: "scenarios", Time: r.elapsed.Seconds()}
+		switch {
+		case r.skipped != "":
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: r.skipped}
+		case len(r.errors) > 0:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: r.errors[0], Text: strings.Join(r.errors, "\n")}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0o644)
+}
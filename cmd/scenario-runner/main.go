@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"order-event-processor/test/scenario"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// result implements scenario.Reporter for one scenario.
+type result struct {
+	name    string
+	errors  []string
+	skipped string
+	elapsed time.Duration
+}
+
+func (r *result) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "base URL of the server")
+	dir := flag.String("dir", scenario.Path, "directory with scenario files")
+	randomIds := flag.Bool("random-ids", true, "rewrite order and event ids so runs do not collide with each other")
+	concurrency := flag.Int("concurrency", 1, "scenarios run at the same time, needs random-ids to avoid collisions")
+	junitPath := flag.String("junit", "", "path of the JUnit XML report, none is written when empty")
+	flag.Parse()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	scenarios, err := scenario.LoadAll(os.DirFS(*dir))
+	if err != nil {
+		log.Error("unable to load scenarios", "error", err)
+		os.Exit(1)
+	}
+	if *concurrency > 1 && !*randomIds {
+		log.Warn("scenarios sharing ids may collide when run concurrently")
+	}
+
+	started := time.Now()
+	results := make([]*result, len(scenarios))
+	semaphore := make(chan struct{}, max(*concurrency, 1))
+	var wg sync.WaitGroup
+	for i, s := range scenarios {
+		results[i] = &result{name: s.Name}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			run(log, scenario.Target{URL: strings.TrimSuffix(*url, "/")}, s, *randomIds, results[i])
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	failed := 0
+	for _, r := range results {
+		if len(r.errors) > 0 {
+			failed++
+		}
+	}
+	if *junitPath != "" {
+		if err := writeJUnit(*junitPath, results, elapsed); err != nil {
+			log.Error("unable to write JUnit report", "error", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("scenarios: %d, failed: %d, elapsed: %s\n", len(results), failed, elapsed.Round(time.Millisecond))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(log *slog.Logger, target scenario.Target, s scenario.Scenario, randomIds bool, r *result) {
+	if s.NeedsFakeClock() {
+		r.skipped = "advance_clock steps need an in-process server"
+		log.Info("skipped scenario", "name", s.Name, "reason", r.skipped)
+		return
+	}
+	if randomIds {
+		s = s.WithRandomIds()
+	}
+
+	started := time.Now()
+	scenario.Run(target, s, r)
+	r.elapsed = time.Since(started)
+
+	if len(r.errors) > 0 {
+		log.Error("scenario failed", "name", s.Name, "order_id", s.OrderID, "errors", r.errors)
+		return
+	}
+	log.Info("scenario passed", "name", s.Name, "order_id", s.OrderID, "elapsed", r.elapsed)
+}
@@ -0,0 +1,410 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/lib/metrics"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"slices"
+	"sort"
+	"time"
+)
+
+var repairsCounter = metrics.NewCounter("order_repairs_total", "Manual changes to orders by action.", "action")
+
+var (
+	ErrOrderFinal        = errors.New("order is already final")
+	ErrNoInOrderEvents   = errors.New("order has no in order events")
+	ErrUnorderable       = errors.New("order events cannot be ordered")
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrInvalidTransition = errors.New("transition is not allowed")
+)
+
+type Storage interface {
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error)
+	GetOrder(ctx context.Context, orderId string) (model.Order, error)
+	InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, events ...model.OrderEvent) error
+	UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error
+	DeleteOrderEvent(ctx context.Context, eventId string) error
+	InsertOrUpdateOrder(ctx context.Context, order model.Order) error
+	DeleteOrder(ctx context.Context, orderId string) error
+	InsertAuditEntry(ctx context.Context, entry model.AuditEntry) error
+	GetAuditEntries(ctx context.Context, orderId string) ([]model.AuditEntry, error)
+}
+
+// Broadcaster delivers events once their transaction ended, the sequence is reserved under the order lock.
+type Broadcaster interface {
+	Reserve(orderId string) uint64
+	Publish(orderId string, sequence uint64, events ...model.OrderEvent)
+}
+
+// Finalizer makes chinazes events final after model.ChinazesFinalizationDelay, like it happens for webhooks.
+type Finalizer interface {
+	ScheduleFinalization(ctx context.Context, event model.OrderEvent)
+}
+
+// Service shows orders with all their events and applies manual changes to them. Every change runs under the order
+// lock, updates the orders row, is broadcast to subscribers and recorded in the audit log.
+type Service struct {
+	log         *slog.Logger
+	storage     Storage
+	broadcaster Broadcaster
+	finalizer   Finalizer
+	clock       clock.Clock
+}
+
+func NewService(log *slog.Logger, storage Storage, broadcaster Broadcaster, finalizer Finalizer, clock clock.Clock) *Service {
+	return &Service{
+		log:         log,
+		storage:     storage,
+		broadcaster: broadcaster,
+		finalizer:   finalizer,
+		clock:       clock,
+	}
+}
+
+// Timeline returns the orders row together with the in order and buffered events of the order.
+func (s *Service) Timeline(ctx context.Context, orderId string) (model.OrderTimeline, error) {
+	events, err := s.storage.GetAllEventsByOrderId(ctx, orderId)
+	if err != nil {
+		return model.OrderTimeline{}, err
+	} else if len(events) == 0 {
+		return model.OrderTimeline{}, storage.OrderNotFound
+	}
+	return s.timelineOf(ctx, orderId, events)
+}
+
+// Reorder recomputes which events are in order from scratch, as if they had arrived by updated_at.
+// Events created by an operator stay in order and events made final before stay final.
+func (s *Service) Reorder(ctx context.Context, orderId string, operator model.OperatorAction) (model.OrderTimeline, error) {
+	return s.repair(ctx, orderId, model.AuditActionReorder, operator, func(ctx context.Context, events []model.OrderEvent) (change, error) {
+		changed, err := s.reorder(ctx, events)
+		if err != nil {
+			return change{}, err
+		}
+		return change{events: changed, details: fmt.Sprintf("%d events changed", len(changed))}, nil
+	})
+}
+
+// Finalize makes the last in order event final, so the order accepts no more events.
+func (s *Service) Finalize(ctx context.Context, orderId string, operator model.OperatorAction) (model.OrderTimeline, error) {
+	return s.repair(ctx, orderId, model.AuditActionFinalize, operator, func(ctx context.Context, events []model.OrderEvent) (change, error) {
+		last, ok := ordering.LastInOrderEvent(events)
+		if !ok {
+			return change{}, ErrNoInOrderEvents
+		} else if last.IsFinal {
+			return change{}, ErrOrderFinal
+		}
+
+		if err := s.storage.UpdateOrderEventFinalStatus(ctx, last.EventID); err != nil {
+			return change{}, err
+		}
+		last.IsFinal = true
+		return change{eventId: last.EventID, events: []model.OrderEvent{last}, details: string(last.OrderStatus)}, nil
+	})
+}
+
+// Transition moves the order to status by creating an in order event marked with the operator and the reason.
+// Unless force is set, status must be allowed after the current status by model.Transitions. Buffered events which
+// may follow the new status become in order.
+func (s *Service) Transition(ctx context.Context, orderId string, status model.OrderStatus, force bool, operator model.OperatorAction) (model.OrderTimeline, error) {
+	if _, ok := model.StatusToIsFinal[status]; !ok {
+		return model.OrderTimeline{}, fmt.Errorf("%w: %s", ErrUnknownStatus, status)
+	}
+
+	action := model.AuditActionTransition
+	if force {
+		action = model.AuditActionForceStatus
+	}
+	return s.repair(ctx, orderId, action, operator, func(ctx context.Context, events []model.OrderEvent) (change, error) {
+		last, ok := ordering.LastInOrderEvent(events)
+		if !ok {
+			return change{}, ErrNoInOrderEvents
+		} else if last.IsFinal {
+			return change{}, ErrOrderFinal
+		} else if !force && !slices.Contains(model.Transitions[last.OrderStatus], status) {
+			return change{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, last.OrderStatus, status)
+		}
+
+		now := s.clock.Now().UTC()
+		// updated right after the last in order event instead of now, so buffered events sent by the payment system
+		// after it can still follow the new status
+		synthetic := model.OrderEvent{
+			EventID: uuid.NewString(),
+			Order: model.Order{
+				OrderID:     orderId,
+				UserID:      last.UserID,
+				OrderStatus: status,
+				IsFinal:     model.StatusToIsFinal[status],
+				UpdatedAt:   last.UpdatedAt.Add(time.Millisecond),
+				CreatedAt:   last.CreatedAt,
+			},
+			InOrder:        true,
+			ReceivedAt:     now,
+			AppliedAt:      &now,
+			OperatorID:     operator.OperatorID,
+			OperatorReason: operator.Reason,
+		}
+
+		promoted, err := ordering.UpdatedInOrderEvents(append(slices.Clone(events), synthetic))
+		if err != nil {
+			return change{}, fmt.Errorf("%w: %w", ErrUnorderable, err)
+		}
+		for i := range promoted {
+			promoted[i].AppliedAt = &now
+		}
+
+		changed := append([]model.OrderEvent{synthetic}, promoted...)
+		if err := s.storage.InsertOrderEventsOrUpdateIsInOrder(ctx, changed...); err != nil {
+			return change{}, err
+		}
+		return change{eventId: synthetic.EventID, events: changed, details: fmt.Sprintf("%s -> %s", last.OrderStatus, status)}, nil
+	})
+}
+
+// AuditLog returns the manual changes made to the order, oldest first.
+func (s *Service) AuditLog(ctx context.Context, orderId string) ([]model.AuditEntry, error) {
+	entries, err := s.storage.GetAuditEntries(ctx, orderId)
+	if err != nil {
+		return nil, err
+	} else if entries == nil {
+		entries = []model.AuditEntry{}
+	}
+	return entries, nil
+}
+
+// DeleteEvent removes an event of the order and reorders the remaining events.
+func (s *Service) DeleteEvent(ctx context.Context, orderId string, eventId string, operator model.OperatorAction) (model.OrderTimeline, error) {
+	return s.repair(ctx, orderId, model.AuditActionDeleteEvent, operator, func(ctx context.Context, events []model.OrderEvent) (change, error) {
+		index := slices.IndexFunc(events, func(event model.OrderEvent) bool {
+			return event.EventID == eventId
+		})
+		if index < 0 {
+			return change{}, storage.EventNotFound
+		}
+		deleted := events[index]
+
+		if err := s.storage.DeleteOrderEvent(ctx, eventId); err != nil {
+			return change{}, err
+		}
+		changed, err := s.reorder(ctx, slices.Delete(events, index, index+1))
+		if err != nil {
+			return change{}, err
+		}
+		return change{eventId: eventId, events: changed, details: string(deleted.OrderStatus)}, nil
+	})
+}
+
+// change is what a manual change did, events are the events it inserted or updated.
+type change struct {
+	eventId string
+	events  []model.OrderEvent
+	details string
+}
+
+// repair runs apply with the events of the order under the order lock, then updates the orders row and records
+// the audit entry. Once the transaction is committed, changed events which are in order are broadcast and chinazes
+// events becoming in order are scheduled for finalization.
+func (s *Service) repair(ctx context.Context, orderId string, action string, operator model.OperatorAction,
+	apply func(ctx context.Context, events []model.OrderEvent) (change, error)) (model.OrderTimeline, error) {
+	var applied change
+	var timeline model.OrderTimeline
+	var sequence uint64
+	err := s.storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.storage.AcquireLock(ctx, orderId); err != nil {
+			return err
+		}
+
+		events, err := s.storage.GetAllEventsByOrderId(ctx, orderId)
+		if err != nil {
+			return err
+		} else if len(events) == 0 {
+			return storage.OrderNotFound
+		}
+
+		applied, err = apply(ctx, events)
+		if err != nil {
+			return err
+		}
+
+		events, err = s.storage.GetAllEventsByOrderId(ctx, orderId)
+		if err != nil {
+			return err
+		}
+		if last, ok := ordering.LastInOrderEvent(events); ok {
+			err = s.storage.InsertOrUpdateOrder(ctx, last.Order)
+		} else {
+			err = s.storage.DeleteOrder(ctx, orderId)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.storage.InsertAuditEntry(ctx, model.AuditEntry{
+			OrderID:    orderId,
+			EventID:    applied.eventId,
+			Action:     action,
+			OperatorID: operator.OperatorID,
+			Reason:     operator.Reason,
+			Details:    applied.details,
+			CreatedAt:  s.clock.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		timeline, err = s.timelineOf(ctx, orderId, events)
+		if err != nil {
+			return err
+		}
+		// reserved under the order lock, so the events are broadcast in commit order once committed
+		sequence = s.broadcaster.Reserve(orderId)
+		return nil
+	})
+	if err != nil {
+		if sequence > 0 {
+			s.broadcaster.Publish(orderId, sequence)
+		}
+		return model.OrderTimeline{}, err
+	}
+
+	var inOrder []model.OrderEvent
+	for _, event := range applied.events {
+		if event.InOrder {
+			inOrder = append(inOrder, event)
+		}
+	}
+	s.broadcaster.Publish(orderId, sequence, inOrder...)
+
+	for _, event := range applied.events {
+		if event.InOrder && event.OrderStatus == model.StatusChinazes && !event.IsFinal {
+			s.finalizer.ScheduleFinalization(ctx, event)
+		}
+	}
+	repairsCounter.Inc(action)
+	logger.FromContext(ctx, s.log).Warn("order changed by operator", "order_id", orderId, "action", action,
+		"operator_id", operator.OperatorID, "reason", operator.Reason, "details", applied.details)
+	return timeline, nil
+}
+
+// reorder resets every event not created by an operator and replays them through ordering.UpdatedInOrderEvents.
+// It returns the events whose is_in_order or is_final changed, sorted by updated_at.
+func (s *Service) reorder(ctx context.Context, events []model.OrderEvent) ([]model.OrderEvent, error) {
+	stored := make(map[string]model.OrderEvent, len(events))
+	reset := make([]model.OrderEvent, 0, len(events))
+	for _, event := range events {
+		stored[event.EventID] = event
+		if event.OperatorID == "" {
+			event.InOrder = false
+			event.IsFinal = false
+		}
+		reset = append(reset, event)
+	}
+
+	inOrder, err := ordering.UpdatedInOrderEvents(reset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnorderable, err)
+	}
+	idToInOrder := make(map[string]model.OrderEvent, len(inOrder))
+	for _, event := range inOrder {
+		idToInOrder[event.EventID] = event
+	}
+
+	now := s.clock.Now().UTC()
+	var changed []model.OrderEvent
+	finalized := false
+	for _, event := range reset {
+		if inOrderEvent, ok := idToInOrder[event.EventID]; ok {
+			event = inOrderEvent
+		}
+		// events finalized by the chinazes job or an operator stay final and nothing follows them
+		if finalized {
+			event.InOrder = false
+			event.IsFinal = false
+		} else if event.InOrder && stored[event.EventID].IsFinal {
+			event.IsFinal = true
+		}
+		finalized = finalized || (event.InOrder && event.IsFinal)
+
+		before := stored[event.EventID]
+		if event.InOrder == before.InOrder && event.IsFinal == before.IsFinal {
+			continue
+		}
+		if event.InOrder && event.AppliedAt == nil {
+			event.AppliedAt = &now
+		}
+		changed = append(changed, event)
+	}
+
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	if err := s.storage.InsertOrderEventsOrUpdateIsInOrder(ctx, changed...); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (s *Service) timelineOf(ctx context.Context, orderId string, events []model.OrderEvent) (model.OrderTimeline, error) {
+	timeline := model.OrderTimeline{
+		OrderID:  orderId,
+		InOrder:  []model.TimelineEvent{},
+		Buffered: []model.TimelineEvent{},
+	}
+	order, err := s.storage.GetOrder(ctx, orderId)
+	if err == nil {
+		timeline.Status = order.OrderStatus
+		timeline.IsFinal = order.IsFinal
+	} else if !errors.Is(err, storage.OrderNotFound) {
+		return model.OrderTimeline{}, err
+	}
+
+	chain := ordering.InOrderChain(events)
+	for _, event := range chain {
+		timeline.InOrder = append(timeline.InOrder, timelineEventOf(event))
+	}
+
+	// in order events missing from the chain are listed after it, so inconsistencies are visible
+	var rest []model.OrderEvent
+	for _, event := range events {
+		if !event.InOrder || !slices.ContainsFunc(chain, func(chained model.OrderEvent) bool {
+			return chained.EventID == event.EventID
+		}) {
+			rest = append(rest, event)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].UpdatedAt.Before(rest[j].UpdatedAt)
+	})
+	for _, event := range rest {
+		if event.InOrder {
+			timeline.InOrder = append(timeline.InOrder, timelineEventOf(event))
+		} else {
+			timeline.Buffered = append(timeline.Buffered, timelineEventOf(event))
+		}
+	}
+	return timeline, nil
+}
+
+func timelineEventOf(event model.OrderEvent) model.TimelineEvent {
+	return model.TimelineEvent{
+		EventID:     event.EventID,
+		OrderStatus: event.OrderStatus,
+		InOrder:     event.InOrder,
+		IsFinal:     event.IsFinal,
+		UpdatedAt:   event.UpdatedAt,
+		ReceivedAt:  event.ReceivedAt,
+		AppliedAt:   event.AppliedAt,
+		OperatorID:  event.OperatorID,
+		Reason:      event.OperatorReason,
+	}
+}
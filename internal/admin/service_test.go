@@ -0,0 +1,274 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	loggerhandler "order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage"
+	"order-event-processor/internal/storage/memory"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+var createdAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var operator = model.OperatorAction{OperatorID: "support", Reason: "ticket 42"}
+
+type recorder struct {
+	mutex     sync.Mutex
+	reserved  uint64
+	published int
+	broadcast []model.OrderEvent
+	scheduled []model.OrderEvent
+}
+
+func (r *recorder) Reserve(_ string) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reserved++
+	return r.reserved
+}
+
+func (r *recorder) Publish(_ string, _ uint64, events ...model.OrderEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.published++
+	r.broadcast = append(r.broadcast, events...)
+}
+
+func (r *recorder) ScheduleFinalization(_ context.Context, event model.OrderEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.scheduled = append(r.scheduled, event)
+}
+
+func newService(t *testing.T, events ...model.OrderEvent) (*Service, *memory.Storage, *recorder) {
+	t.Helper()
+	store := memory.New()
+	if err := store.InsertOrderEventsOrUpdateIsInOrder(context.Background(), events...); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recorder{}
+	return NewService(slog.New(loggerhandler.NewNoOpHandler()), store, recorder, recorder, clock.NewFake(createdAt.Add(time.Hour))), store, recorder
+}
+
+func event(id string, status model.OrderStatus, minutes int, inOrder bool) model.OrderEvent {
+	return model.OrderEvent{
+		EventID: id,
+		Order: model.Order{
+			OrderID:     "order",
+			UserID:      "user",
+			OrderStatus: status,
+			IsFinal:     inOrder && model.StatusToIsFinal[status],
+			UpdatedAt:   createdAt.Add(time.Duration(minutes) * time.Minute),
+			CreatedAt:   createdAt,
+		},
+		InOrder: inOrder,
+	}
+}
+
+func ids(events []model.TimelineEvent) []string {
+	var eventIds []string
+	for _, event := range events {
+		eventIds = append(eventIds, event.EventID)
+	}
+	return eventIds
+}
+
+func TestService_ForcedTransitionPromotesBufferedEvents(t *testing.T) {
+	service, store, recorder := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusSbuVerificationPending, 1, true),
+		event("4", model.StatusChinazes, 3, false),
+	)
+
+	timeline, err := service.Transition(context.Background(), "order", model.StatusConfirmedByMayor, true, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timeline.InOrder) != 4 || timeline.InOrder[2].OperatorID != "support" || timeline.InOrder[2].Reason != "ticket 42" || timeline.InOrder[3].EventID != "4" {
+		t.Errorf("expected forced event followed by the buffered one but got %+v", timeline.InOrder)
+	}
+	if len(timeline.Buffered) != 0 || timeline.Status != model.StatusChinazes {
+		t.Errorf("expected chinazes order without buffered events but got %+v", timeline)
+	}
+	if len(recorder.broadcast) != 2 || recorder.broadcast[1].EventID != "4" {
+		t.Errorf("expected forced and promoted events to be broadcast but got %+v", recorder.broadcast)
+	}
+	if len(recorder.scheduled) != 1 || recorder.scheduled[0].EventID != "4" {
+		t.Errorf("expected chinazes event to be scheduled for finalization but got %+v", recorder.scheduled)
+	}
+
+	order, err := store.GetOrder(context.Background(), "order")
+	if err != nil || order.OrderStatus != model.StatusChinazes {
+		t.Errorf("expected chinazes orders row but got %+v, %v", order, err)
+	}
+
+	entries, err := service.AuditLog(context.Background(), "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := model.AuditEntry{ID: 1, OrderID: "order", EventID: timeline.InOrder[2].EventID, Action: model.AuditActionForceStatus,
+		OperatorID: "support", Reason: "ticket 42", Details: "sbu_verification_pending -> confirmed_by_mayor", CreatedAt: createdAt.Add(time.Hour)}
+	if len(entries) != 1 || entries[0] != expected {
+		t.Errorf("expected audit entry %+v but got %+v", expected, entries)
+	}
+}
+
+func TestService_TransitionFollowsTransitions(t *testing.T) {
+	service, _, _ := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusSbuVerificationPending, 1, true),
+	)
+
+	if _, err := service.Transition(context.Background(), "order", model.StatusChinazes, false, operator); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected invalid transition but got %v", err)
+	}
+	timeline, err := service.Transition(context.Background(), "order", model.StatusConfirmedByMayor, false, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeline.Status != model.StatusConfirmedByMayor {
+		t.Errorf("expected confirmed_by_mayor order but got %+v", timeline)
+	}
+
+	entries, err := service.AuditLog(context.Background(), "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != model.AuditActionTransition {
+		t.Errorf("expected only the applied transition to be audited but got %+v", entries)
+	}
+}
+
+func TestService_ReorderKeepsFinalizedEvents(t *testing.T) {
+	finalized := event("3", model.StatusConfirmedByMayor, 2, true)
+	finalized.IsFinal = true
+	service, _, recorder := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusSbuVerificationPending, 1, false),
+		finalized,
+		event("4", model.StatusChinazes, 3, false),
+	)
+
+	timeline, err := service.Reorder(context.Background(), "order", operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ids(timeline.InOrder), []string{"1", "2", "3"}) || !slices.Equal(ids(timeline.Buffered), []string{"4"}) {
+		t.Errorf("expected 1, 2, 3 in order and 4 buffered but got %+v", timeline)
+	}
+	if !timeline.InOrder[2].IsFinal {
+		t.Errorf("expected finalized event to stay final")
+	}
+	if len(recorder.broadcast) != 1 || recorder.broadcast[0].EventID != "2" {
+		t.Errorf("expected only the promoted event to be broadcast but got %+v", recorder.broadcast)
+	}
+}
+
+func TestService_DeleteEventReordersRemainingEvents(t *testing.T) {
+	service, store, _ := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusSbuVerificationPending, 1, true),
+		event("3", model.StatusConfirmedByMayor, 2, true),
+	)
+
+	timeline, err := service.DeleteEvent(context.Background(), "order", "2", operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ids(timeline.InOrder), []string{"1"}) || !slices.Equal(ids(timeline.Buffered), []string{"3"}) {
+		t.Errorf("expected 1 in order and 3 buffered but got %+v", timeline)
+	}
+	order, err := store.GetOrder(context.Background(), "order")
+	if err != nil || order.OrderStatus != model.StatusCoolOrderCreated {
+		t.Errorf("expected cool_order_created orders row but got %+v, %v", order, err)
+	}
+}
+
+func TestService_Errors(t *testing.T) {
+	service, _, recorder := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusFailed, 1, true),
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		change   func() error
+		expected error
+	}{
+		{"finalize final order", func() error {
+			_, err := service.Finalize(ctx, "order", operator)
+			return err
+		}, ErrOrderFinal},
+		{"force status of final order", func() error {
+			_, err := service.Transition(ctx, "order", model.StatusChinazes, true, operator)
+			return err
+		}, ErrOrderFinal},
+		{"force unknown status", func() error {
+			_, err := service.Transition(ctx, "order", "shipped", true, operator)
+			return err
+		}, ErrUnknownStatus},
+		{"unknown order", func() error {
+			_, err := service.Reorder(ctx, "other", operator)
+			return err
+		}, storage.OrderNotFound},
+		{"unknown event", func() error {
+			_, err := service.DeleteEvent(ctx, "order", "4", operator)
+			return err
+		}, storage.EventNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.change(); !errors.Is(err, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, err)
+			}
+		})
+	}
+	if len(recorder.broadcast) != 0 {
+		t.Errorf("expected failed changes not to broadcast but got %+v", recorder.broadcast)
+	}
+}
+
+// failingCommit runs changes like memory.Storage but fails the transaction once they succeeded.
+type failingCommit struct {
+	*memory.Storage
+}
+
+func (s failingCommit) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	return s.Storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := run(ctx); err != nil {
+			return err
+		}
+		return errCommit
+	})
+}
+
+var errCommit = errors.New("commit failed")
+
+func TestService_FailedCommitIsNotBroadcast(t *testing.T) {
+	_, store, recorder := newService(t,
+		event("1", model.StatusCoolOrderCreated, 0, true),
+		event("2", model.StatusSbuVerificationPending, 1, true),
+	)
+	service := NewService(slog.New(loggerhandler.NewNoOpHandler()), failingCommit{store}, recorder, recorder, clock.NewFake(createdAt.Add(time.Hour)))
+
+	if _, err := service.Transition(context.Background(), "order", model.StatusConfirmedByMayor, false, operator); !errors.Is(err, errCommit) {
+		t.Fatalf("expected %v but got %v", errCommit, err)
+	}
+	if len(recorder.broadcast) != 0 {
+		t.Errorf("expected nothing to be broadcast but got %+v", recorder.broadcast)
+	}
+	if recorder.published != int(recorder.reserved) {
+		t.Errorf("expected every reserved sequence to be published but reserved %d and published %d", recorder.reserved, recorder.published)
+	}
+}
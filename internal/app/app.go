@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/admin"
+	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/buffer"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/handler"
+	"order-event-processor/internal/health"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/lib/metrics"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/projection"
+	"order-event-processor/internal/stats"
+	"order-event-processor/internal/storage/faulty"
+	"order-event-processor/internal/storage/traced"
+	"order-event-processor/internal/tracing"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout bounds a readiness probe, orchestrators usually give up after a few seconds.
+const readinessTimeout = 2 * time.Second
+
+var errShuttingDown = errors.New("shutting down")
+
+// Storage is implemented by every storage backend the server can run with.
+type Storage interface {
+	handler.OrderEventRepository
+	admin.Storage
+	handler.OrdersFinder
+	health.Pinger
+	broadcaster.FromDbEventProducerStorage
+	buffer.Storage
+	projection.Storage
+	projection.ReconcilerStorage
+	stats.Storage
+}
+
+// App wires handlers and background jobs around a storage, it is shared by the server and in-process tests.
+type App struct {
+	log                       *slog.Logger
+	cfg                       atomic.Pointer[config.Config]
+	router                    *http.ServeMux
+	orderEventStreamHandler   *handler.OrderEventStreamHandler
+	broadcaster               *broadcaster.OrderEventBroadcaster
+	paymentSystemEventHandler *handler.PaymentSystemEventHandler
+	bufferMonitor             *buffer.Monitor
+	reconciler                *projection.Reconciler
+	checker                   *health.Checker
+	poolStats                 handler.PoolStatsProvider
+	clock                     clock.Clock
+	startedAt                 time.Time
+	stopBackgroundJobs        context.CancelFunc
+	backgroundJobs            sync.WaitGroup
+	logLevel                  *slog.LevelVar
+	reloadMutex               sync.Mutex
+}
+
+func New(log *slog.Logger, cfg *config.Config, storage Storage, clock clock.Clock) *App {
+	validate := validator.New()
+	router := http.NewServeMux()
+	a := &App{
+		log:                log,
+		router:             router,
+		checker:            health.NewChecker(readinessTimeout),
+		clock:              clock,
+		startedAt:          clock.Now(),
+		stopBackgroundJobs: func() {},
+	}
+	a.cfg.Store(cfg)
+	// looked up before wrapping, the fault injecting storage has no pool
+	a.poolStats, _ = storage.(handler.PoolStatsProvider)
+
+	if cfg.Admin.Token == "" {
+		log.Warn("admin.token is not set, the admin endpoints reject every request")
+	}
+	if cfg.Admin.FaultInjection {
+		log.Warn("storage fault injection is enabled")
+		faultyStorage := faulty.New(storage)
+		storage = faultyStorage
+		faultsHandler := handler.NewFaultsHandler(log, validate, faultyStorage)
+		a.handleAdmin("GET /admin/faults", faultsHandler.GetFaults)
+		a.handleAdmin("PUT /admin/faults", faultsHandler.SetFaults)
+		a.handleAdmin("DELETE /admin/faults", faultsHandler.ClearFaults)
+	}
+
+	// outside the fault injection, so injected latency shows up in traces
+	storage = traced.New(storage)
+
+	producer := broadcaster.NewFromDbEventProducer(storage)
+	orderEventBroadcaster := broadcaster.NewOrderEventBroadcaster(producer)
+	producer.OrderEventBroadcaster = orderEventBroadcaster
+	paymentSystemEventHandler := handler.NewPaymentSystemEventHandler(log, validate, storage, orderEventBroadcaster, clock)
+	orderEventStreamHandler := handler.NewOrderEventStreamHandler(log, orderEventBroadcaster, clock, cfg.Stream.Timeout)
+	ordersHandler := handler.NewOrdersHandler(log, storage)
+	bufferMonitor := buffer.NewMonitor(log, storage, cfg.Buffer.MaxWait, clock)
+	bufferedOrdersHandler := handler.NewBufferedOrdersHandler(log, bufferMonitor)
+
+	rebuilder := projection.NewRebuilder(log, storage, cfg.Projection.BatchSize, cfg.Projection.Workers, clock)
+	projectionsHandler := handler.NewProjectionsHandler(log, rebuilder)
+
+	reconciler := projection.NewReconciler(log, storage, cfg.Reconciliation.AutoRepair, clock)
+	reconciliationHandler := handler.NewReconciliationHandler(log, reconciler)
+
+	statsHandler := handler.NewStatsHandler(log, stats.NewService(storage, clock))
+
+	repairer := admin.NewService(log, storage, orderEventBroadcaster, paymentSystemEventHandler, clock)
+	adminOrdersHandler := handler.NewAdminOrdersHandler(log, validate, repairer)
+
+	a.handle("POST /webhooks/payments/orders", paymentSystemEventHandler.Handle)
+	a.handle("GET /orders/{order_id}/events", orderEventStreamHandler.StreamOrderEvents)
+	a.handle("GET /orders", ordersHandler.GetAllOrders)
+	a.handle("GET /orders/{order_id}", ordersHandler.GetOrder)
+	a.handle("GET /orders/buffered", bufferedOrdersHandler.GetBufferedOrders)
+	a.handleAdmin("POST /admin/projections/rebuild", projectionsHandler.Rebuild)
+	a.handle("GET /stats", statsHandler.GetEventStats)
+	a.handleAdmin("GET /admin/reconciliation", reconciliationHandler.GetMismatches)
+	a.handleAdmin("POST /admin/reconciliation", reconciliationHandler.Reconcile)
+	a.handleAdmin("GET /admin/orders/{order_id}/timeline", adminOrdersHandler.GetTimeline)
+	a.handleAdmin("POST /admin/orders/{order_id}/reorder", adminOrdersHandler.Reorder)
+	a.handleAdmin("POST /admin/orders/{order_id}/finalize", adminOrdersHandler.Finalize)
+	a.handleAdmin("POST /admin/orders/{order_id}/transitions", adminOrdersHandler.Transition)
+	a.handleAdmin("DELETE /admin/orders/{order_id}/events/{event_id}", adminOrdersHandler.DeleteEvent)
+	a.handleAdmin("GET /admin/orders/{order_id}/audit", adminOrdersHandler.GetAuditLog)
+	router.Handle("GET /metrics", metrics.Handler(metrics.Default, a.poolMetrics()))
+
+	a.broadcaster = orderEventBroadcaster
+	a.orderEventStreamHandler = orderEventStreamHandler
+	a.paymentSystemEventHandler = paymentSystemEventHandler
+	a.bufferMonitor = bufferMonitor
+	a.reconciler = reconciler
+
+	a.checker.Add("database", storage.Ping)
+	a.checker.Add("shutdown", a.checkNotShuttingDown)
+	healthHandler := handler.NewHealthHandler(log, a.checker, a)
+	router.HandleFunc("GET /healthz", healthHandler.Healthz)
+	router.HandleFunc("GET /readyz", healthHandler.Readyz)
+	a.handleAdmin("GET /admin/status", healthHandler.GetStatus)
+
+	return a
+}
+
+// Handler logs every request, probes and metrics scrapes only at debug level.
+func (a *App) Handler() http.Handler {
+	return logger.Middleware(a.log, a.router, "/healthz", "/readyz", "/metrics")
+}
+
+// StartBackgroundJobs starts the buffer monitor and the reconciler, they run until Shutdown.
+func (a *App) StartBackgroundJobs() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopBackgroundJobs = cancel
+	a.backgroundJobs.Add(2)
+	go func() {
+		defer a.backgroundJobs.Done()
+		a.bufferMonitor.Run(ctx, func() time.Duration { return a.cfg.Load().Buffer.CheckInterval })
+	}()
+	go func() {
+		defer a.backgroundJobs.Done()
+		a.reconciler.Run(ctx, func() time.Duration { return a.cfg.Load().Reconciliation.Interval })
+	}()
+}
+
+// CloseStreams sends a terminal frame to every event stream and ends it, streams opened afterwards end right away.
+// It is meant to run once the server stopped accepting connections, so http.Server.Shutdown does not wait for streams.
+func (a *App) CloseStreams() {
+	a.broadcaster.Shutdown()
+}
+
+// Shutdown closes event streams, stops background jobs and waits for them and for pending chinazes finalizations.
+// It returns ctx.Err() if ctx is done first, the remaining jobs are abandoned.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.CloseStreams()
+	a.stopBackgroundJobs()
+
+	done := make(chan struct{})
+	go func() {
+		a.backgroundJobs.Wait()
+		a.paymentSystemEventHandler.WaitForJobs()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		a.log.Warn("background jobs did not finish before shutdown deadline", "pending_finalizations", a.paymentSystemEventHandler.PendingFinalizations())
+		return ctx.Err()
+	}
+}
+
+// handle registers a traced route, probes and metrics are registered on the router directly to keep them out of traces.
+func (a *App) handle(pattern string, handler http.HandlerFunc) {
+	a.router.Handle(pattern, tracing.Middleware(pattern, handler))
+}
+
+// handleAdmin registers a traced route which needs the admin token.
+func (a *App) handleAdmin(pattern string, handler http.HandlerFunc) {
+	a.handle(pattern, a.requireAdminToken(handler))
+}
+
+// poolMetrics exports the stats of the storage connection pool, the registry is empty for storages without a pool.
+func (a *App) poolMetrics() *metrics.Registry {
+	registry := metrics.NewRegistry()
+	if a.poolStats == nil {
+		return registry
+	}
+	registry.NewGaugeFunc("db_pool_max_conns", "Maximum size of the connection pool.", func() float64 {
+		return float64(a.poolStats.PoolStats().MaxConns)
+	})
+	registry.NewGaugeFunc("db_pool_total_conns", "Open connections of the pool.", func() float64 {
+		return float64(a.poolStats.PoolStats().TotalConns)
+	})
+	registry.NewGaugeFunc("db_pool_acquired_conns", "Connections currently in use.", func() float64 {
+		return float64(a.poolStats.PoolStats().AcquiredConns)
+	})
+	registry.NewGaugeFunc("db_pool_idle_conns", "Idle connections of the pool.", func() float64 {
+		return float64(a.poolStats.PoolStats().IdleConns)
+	})
+	registry.NewCounterFunc("db_pool_wait_count_total", "Acquires which had to wait for a connection.", func() float64 {
+		return float64(a.poolStats.PoolStats().WaitCount)
+	})
+	registry.NewCounterFunc("db_pool_wait_duration_seconds_total", "Total time spent acquiring connections.", func() float64 {
+		return float64(a.poolStats.PoolStats().WaitDurationMs) / 1000
+	})
+	return registry
+}
+
+// AddReadinessCheck adds a check to /readyz for resources set up outside of the app, such as migrations.
+func (a *App) AddReadinessCheck(name string, check health.CheckFunc) {
+	a.checker.Add(name, check)
+}
+
+// checkNotShuttingDown fails once streams are closed, so the orchestrator stops routing traffic while the server drains.
+func (a *App) checkNotShuttingDown(_ context.Context) error {
+	select {
+	case <-a.broadcaster.Done():
+		return errShuttingDown
+	default:
+		return nil
+	}
+}
+
+// Status reports readiness together with pool, stream and scheduler stats for operators.
+func (a *App) Status(ctx context.Context) (model.ServerStatus, error) {
+	bufferedOrders, err := a.bufferMonitor.GetBufferedOrders(ctx)
+	if err != nil {
+		return model.ServerStatus{}, err
+	}
+
+	now := a.clock.Now()
+	status := model.ServerStatus{
+		Env:           a.cfg.Load().Env,
+		StartedAt:     a.startedAt,
+		UptimeSeconds: now.Sub(a.startedAt).Seconds(),
+		Readiness:     a.checker.CheckReadiness(ctx),
+		Streams:       a.broadcaster.Stats(),
+		Scheduler: model.SchedulerStats{
+			PendingFinalizations: a.paymentSystemEventHandler.PendingFinalizations(),
+			BufferedOrders:       len(bufferedOrders),
+		},
+	}
+	for _, bufferedOrder := range bufferedOrders {
+		status.Scheduler.BufferedEvents += len(bufferedOrder.BufferedEvents)
+	}
+	if a.poolStats != nil {
+		poolStats := a.poolStats.PoolStats()
+		status.Pool = &poolStats
+	}
+	return status, nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"log/slog"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/lib/metrics"
+	"strconv"
+	"time"
+)
+
+const (
+	reloadApplied   = "applied"
+	reloadUnchanged = "unchanged"
+	reloadRejected  = "rejected"
+)
+
+var (
+	configReloadsMetric = metrics.NewCounter("config_reloads_total",
+		"Config reloads by result: applied, unchanged or rejected by loading or validation.", "result")
+	configChangesMetric = metrics.NewCounter("config_changes_total",
+		"Changed config values seen by reloads, reloaded is false for values that need a restart.", "key", "reloaded")
+	configReloadedAtMetric = metrics.NewGauge("config_last_reload_success_timestamp_seconds",
+		"Unix time of the last reload that applied a change.")
+)
+
+// UseLogLevel lets Reload change the level of the logger the app was created with.
+func (a *App) UseLogLevel(level *slog.LevelVar) {
+	a.logLevel = level
+}
+
+// Reload reads the config with load and applies its reloadable values, load is expected to validate it.
+// When load fails the current config stays in place. Changed values that need a restart are logged and kept.
+func (a *App) Reload(load func() (*config.Config, error)) error {
+	a.reloadMutex.Lock()
+	defer a.reloadMutex.Unlock()
+
+	next, err := load()
+	if err != nil {
+		configReloadsMetric.Inc(reloadRejected)
+		a.log.Error("config reload rejected, keeping the current config", "error", err)
+		return err
+	}
+
+	current := a.cfg.Load()
+	changes := current.Diff(next)
+	reloaded := false
+	for _, change := range changes {
+		configChangesMetric.Inc(change.Key, strconv.FormatBool(change.Reloadable))
+		if change.Reloadable {
+			reloaded = true
+			a.log.Info("config value reloaded", "key", change.Key, "old", change.Old, "new", change.New)
+		} else {
+			a.log.Warn("config value changed but needs a restart", "key", change.Key, "old", change.Old, "new", change.New)
+		}
+	}
+	if !reloaded {
+		configReloadsMetric.Inc(reloadUnchanged)
+		return nil
+	}
+
+	cfg := current.Reload(next)
+	if a.logLevel != nil {
+		// validated by load
+		level, _ := logger.ParseLevel(cfg.Log.Level)
+		a.logLevel.Set(level)
+	}
+	a.orderEventStreamHandler.SetTimeout(cfg.Stream.Timeout)
+	a.bufferMonitor.SetMaxWait(cfg.Buffer.MaxWait)
+	a.reconciler.SetAutoRepair(cfg.Reconciliation.AutoRepair)
+	// intervals are read by the background jobs before every wait
+	a.cfg.Store(cfg)
+
+	configReloadsMetric.Inc(reloadApplied)
+	configReloadedAtMetric.Set(float64(a.clock.Now().UnixNano()) / float64(time.Second))
+	return nil
+}
@@ -1,13 +1,15 @@
 package broadcaster
 
 import (
+	"context"
 	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
 )
 
 type FromDbEventProducerStorage interface {
-	RunInTransaction(f func()) error
-	AcquireLock(id string) error
-	GetAllEventsByOrderId(orderId string) ([]model.OrderEvent, error)
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error)
 }
 
 type FromDbEventProducer struct {
@@ -21,21 +23,39 @@ func NewFromDbEventProducer(repository FromDbEventProducerStorage) *FromDbEventP
 	}
 }
 
-func (p *FromDbEventProducer) OnRegistration(orderId string, channel chan *model.OrderEvent) {
-	go p.produce(orderId, channel)
+func (p *FromDbEventProducer) OnRegistration(subscription *Subscription) {
+	go p.produce(subscription)
 }
 
-func (p *FromDbEventProducer) produce(orderId string, channel chan *model.OrderEvent) {
-	p.repository.RunInTransaction(func() {
-		p.repository.AcquireLock(orderId)
+func (p *FromDbEventProducer) produce(subscription *Subscription) {
+	orderId := subscription.orderId
+	p.repository.RunInTransaction(context.Background(), func(ctx context.Context) error {
+		if err := p.repository.AcquireLock(ctx, orderId); err != nil {
+			p.OrderEventBroadcaster.UnregisterChannel(subscription, DropReasonReplayFailed)
+			return err
+		}
 
-		events, err := p.repository.GetAllEventsByOrderId(orderId)
+		events, err := p.repository.GetAllEventsByOrderId(ctx, orderId)
 		if err != nil {
-			p.OrderEventBroadcaster.UnregisterChannel(orderId, channel)
+			p.OrderEventBroadcaster.UnregisterChannel(subscription, DropReasonReplayFailed)
 			// todo log
+			return err
+		}
+		// events still buffered out of order are broadcast by the handler once they become in order
+		chain := ordering.InOrderChain(events)
+		for i := range chain {
+			if !subscription.send(&chain[i]) {
+				// the stream went away during the replay, its channel is not read anymore
+				return nil
+			}
 		}
-		for _, event := range events {
-			p.OrderEventBroadcaster.Broadcast(&event)
+		if len(chain) > 0 && chain[len(chain)-1].IsFinal {
+			close(subscription.channel)
+			return nil
 		}
+		// the subscription is attached under the order lock, so an event committed concurrently is either
+		// replayed above or broadcast to it by its handler, never both
+		p.OrderEventBroadcaster.attach(subscription)
+		return nil
 	})
 }
@@ -1,70 +1,252 @@
 package broadcaster
 
 import (
+	"order-event-processor/internal/lib/metrics"
 	"order-event-processor/internal/model"
 	"slices"
 	"sync"
 )
 
+var (
+	subscribersGauge = metrics.NewGauge("order_event_subscribers",
+		"Event streams attached to the broadcaster.")
+	broadcastsCounter = metrics.NewCounter("order_event_broadcasts_total",
+		"Events broadcast to subscribers of their order.")
+	deliveriesCounter = metrics.NewCounter("order_event_deliveries_total",
+		"Events delivered to a subscriber, a broadcast to n subscribers counts n times.")
+	droppedSubscribersCounter = metrics.NewCounter("order_event_subscribers_dropped_total",
+		"Event streams ended before a final event of their order, by reason.", "reason")
+)
+
+// Reasons for unregistering a channel, they label droppedSubscribersCounter.
+const (
+	DropReasonTimeout      = "timeout"
+	DropReasonClientGone   = "client_gone"
+	DropReasonShutdown     = "shutdown"
+	DropReasonReplayFailed = "replay_failed"
+)
+
+// RegistrationListener replays past events to a registered subscription, attaches it to the broadcaster afterwards
+// and closes its subscribed channel.
 type RegistrationListener interface {
-	OnRegistration(orderId string, channel chan *model.OrderEvent)
+	OnRegistration(subscription *Subscription)
+}
+
+// Subscription delivers events of one order to a stream. Its channel is closed by whoever sends the final event,
+// the replay or Publish, unregistering closes done instead so that senders give up without racing the close.
+type Subscription struct {
+	orderId    string
+	channel    chan *model.OrderEvent
+	subscribed chan struct{}
+	done       chan struct{}
+	unregister sync.Once
+	// after is the last sequence reserved when the subscription was attached, events published with it or
+	// an earlier one were committed before the replay read the events of the order.
+	after uint64
+}
+
+// Subscribed is closed once broadcast events are delivered to the subscription too.
+func (s *Subscription) Subscribed() <-chan struct{} {
+	return s.subscribed
+}
+
+// Done is closed once the subscription is unregistered, by the stream or by a failed replay.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// send waits until event is delivered or the subscription is unregistered and reports whether it was delivered.
+func (s *Subscription) send(event *model.OrderEvent) bool {
+	select {
+	case s.channel <- event:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// orderStream delivers the events of one order. Transactions reserve a sequence under the order lock and publish
+// their events with it once they ended, events are delivered by sequence, so subscribers receive them in the order
+// they were committed although they are published after the commit.
+type orderStream struct {
+	reserved  uint64
+	delivered uint64
+	// pending keeps events published before an earlier sequence, nil for transactions that rolled back
+	pending       map[uint64][]model.OrderEvent
+	subscriptions []*Subscription
 }
 
 type OrderEventBroadcaster struct {
 	mutex                sync.Mutex
-	orderIdToChannels    map[string][]chan *model.OrderEvent
+	orderIdToStream      map[string]*orderStream
 	registrationListener RegistrationListener
+	shutdown             chan struct{}
+	shutdownOnce         sync.Once
 }
 
 func NewOrderEventBroadcaster(listener RegistrationListener) *OrderEventBroadcaster {
 	return &OrderEventBroadcaster{
-		orderIdToChannels:    make(map[string][]chan *model.OrderEvent),
+		orderIdToStream:      make(map[string]*orderStream),
 		registrationListener: listener,
+		shutdown:             make(chan struct{}),
 	}
 }
 
-func (b *OrderEventBroadcaster) Broadcast(event *model.OrderEvent) {
+// Shutdown closes the channel returned by Done, subscribers are expected to send a terminal frame and unregister.
+func (b *OrderEventBroadcaster) Shutdown() {
+	b.shutdownOnce.Do(func() {
+		close(b.shutdown)
+	})
+}
+
+// Done is closed once Shutdown is called.
+func (b *OrderEventBroadcaster) Done() <-chan struct{} {
+	return b.shutdown
+}
+
+// Reserve returns the sequence the caller publishes its events of the order with, it must be called under
+// the order lock and every sequence must be published, with no events if the transaction rolled back.
+func (b *OrderEventBroadcaster) Reserve(orderId string) uint64 {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	channels := b.orderIdToChannels[event.OrderID]
-	for _, channel := range channels {
-		channel <- event
+	stream := b.streamOf(orderId)
+	stream.reserved++
+	return stream.reserved
+}
+
+// Publish delivers events reserved with sequence once the events of every earlier sequence were delivered.
+func (b *OrderEventBroadcaster) Publish(orderId string, sequence uint64, events ...model.OrderEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	stream, ok := b.orderIdToStream[orderId]
+	if !ok || sequence <= stream.delivered {
+		return
 	}
-	if event.IsFinal {
-		for _, channel := range channels {
-			close(channel)
-			delete(b.orderIdToChannels, event.OrderID)
+	stream.pending[sequence] = events
+	for {
+		next, ok := stream.pending[stream.delivered+1]
+		if !ok {
+			break
+		}
+		delete(stream.pending, stream.delivered+1)
+		stream.delivered++
+		for i := range next {
+			b.deliver(stream, stream.delivered, &next[i])
 		}
 	}
+	b.dropIdle(orderId, stream)
 }
 
-func (b *OrderEventBroadcaster) UnregisterChannel(orderId string, channel chan *model.OrderEvent) {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
-	close(channel)
+// Broadcast delivers event like a transaction that reserved a sequence and committed right away.
+func (b *OrderEventBroadcaster) Broadcast(event *model.OrderEvent) {
+	b.Publish(event.OrderID, b.Reserve(event.OrderID), *event)
+}
 
-	channels, ok := b.orderIdToChannels[orderId]
-	if !ok {
+func (b *OrderEventBroadcaster) deliver(stream *orderStream, sequence uint64, event *model.OrderEvent) {
+	delivered := 0
+	for _, subscription := range stream.subscriptions {
+		if subscription.after < sequence && subscription.send(event) {
+			delivered++
+		}
+	}
+	broadcastsCounter.Inc()
+	deliveriesCounter.Add(float64(delivered))
+	if !event.IsFinal {
 		return
 	}
-	index := slices.Index(channels, channel)
-	if index >= 0 {
-		b.orderIdToChannels[orderId] = slices.Delete(channels, index, index+1)
+	remaining := stream.subscriptions[:0]
+	for _, subscription := range stream.subscriptions {
+		if subscription.after < sequence {
+			close(subscription.channel)
+			subscribersGauge.Add(-1)
+		} else {
+			remaining = append(remaining, subscription)
+		}
+	}
+	stream.subscriptions = remaining
+}
+
+func (b *OrderEventBroadcaster) streamOf(orderId string) *orderStream {
+	stream, ok := b.orderIdToStream[orderId]
+	if !ok {
+		stream = &orderStream{pending: make(map[uint64][]model.OrderEvent)}
+		b.orderIdToStream[orderId] = stream
 	}
+	return stream
 }
 
-func (b *OrderEventBroadcaster) RegisterChannel(orderId string, channel chan *model.OrderEvent) {
-	b.addChannelToMap(orderId, channel)
-	b.registrationListener.OnRegistration(orderId, channel)
+// dropIdle forgets the stream of the order once it has no subscribers and no reserved sequence is outstanding.
+func (b *OrderEventBroadcaster) dropIdle(orderId string, stream *orderStream) {
+	if len(stream.subscriptions) == 0 && stream.delivered == stream.reserved {
+		delete(b.orderIdToStream, orderId)
+	}
 }
 
-func (b *OrderEventBroadcaster) addChannelToMap(orderId string, channel chan *model.OrderEvent) {
+// UnregisterChannel stops delivering to subscription and detaches it if it was attached, reason is one of
+// the DropReason constants. The channel of the subscription is left open, only Done is closed.
+func (b *OrderEventBroadcaster) UnregisterChannel(subscription *Subscription, reason string) {
+	subscription.unregister.Do(func() {
+		// closed before taking the mutex, Publish holds it while it waits to send to the subscription
+		close(subscription.done)
+		droppedSubscribersCounter.Inc(reason)
+
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		stream, ok := b.orderIdToStream[subscription.orderId]
+		if !ok {
+			return
+		}
+		index := slices.Index(stream.subscriptions, subscription)
+		if index >= 0 {
+			stream.subscriptions = slices.Delete(stream.subscriptions, index, index+1)
+			subscribersGauge.Add(-1)
+		}
+		b.dropIdle(subscription.orderId, stream)
+	})
+}
+
+// RegisterChannel replays past events of the order to channel, the returned subscription is subscribed
+// once broadcast events are delivered to channel too.
+func (b *OrderEventBroadcaster) RegisterChannel(orderId string, channel chan *model.OrderEvent) *Subscription {
+	subscription := &Subscription{
+		orderId:    orderId,
+		channel:    channel,
+		subscribed: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	b.registrationListener.OnRegistration(subscription)
+	return subscription
+}
+
+// attach delivers events published from now on to subscription and closes its subscribed channel, it must be
+// called under the order lock. It reports false without attaching if the subscription was unregistered meanwhile.
+func (b *OrderEventBroadcaster) attach(subscription *Subscription) bool {
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
-	channels, ok := b.orderIdToChannels[orderId]
-	if !ok {
-		b.orderIdToChannels[orderId] = []chan *model.OrderEvent{channel}
-	} else {
-		b.orderIdToChannels[orderId] = append(channels, channel)
+	select {
+	case <-subscription.done:
+		return false
+	default:
+	}
+	stream := b.streamOf(subscription.orderId)
+	// transactions holding earlier sequences ended before the order lock was taken, the replay read their events
+	subscription.after = stream.reserved
+	stream.subscriptions = append(stream.subscriptions, subscription)
+	subscribersGauge.Add(1)
+	close(subscription.subscribed)
+	return true
+}
+
+// Stats counts orders with attached subscribers and the subscribers themselves.
+func (b *OrderEventBroadcaster) Stats() model.StreamStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var stats model.StreamStats
+	for _, stream := range b.orderIdToStream {
+		if len(stream.subscriptions) > 0 {
+			stats.Orders++
+			stats.Subscribers += len(stream.subscriptions)
+		}
 	}
+	return stats
 }
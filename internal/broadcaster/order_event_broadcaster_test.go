@@ -0,0 +1,161 @@
+package broadcaster
+
+import (
+	"fmt"
+	"order-event-processor/internal/model"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// attachingListener attaches channels without replaying anything.
+type attachingListener struct {
+	broadcaster *OrderEventBroadcaster
+}
+
+func (l *attachingListener) OnRegistration(subscription *Subscription) {
+	l.broadcaster.attach(subscription)
+}
+
+// TestOrderEventBroadcaster_UnregisterWhileBroadcasting unregisters a subscriber that stopped reading while
+// Broadcast waits to send to it, Broadcast gives up and the final event does not close the channel twice.
+func TestOrderEventBroadcaster_UnregisterWhileBroadcasting(t *testing.T) {
+	listener := &attachingListener{}
+	broadcaster := NewOrderEventBroadcaster(listener)
+	listener.broadcaster = broadcaster
+
+	subscription := broadcaster.RegisterChannel("order", make(chan *model.OrderEvent))
+	<-subscription.Subscribed()
+
+	broadcast := make(chan struct{})
+	go func() {
+		broadcaster.Broadcast(&model.OrderEvent{EventID: "event", Order: model.Order{OrderID: "order", OrderStatus: model.StatusCoolOrderCreated}})
+		close(broadcast)
+	}()
+	// lets Broadcast take the mutex and block on the send first
+	time.Sleep(10 * time.Millisecond)
+	broadcaster.UnregisterChannel(subscription, DropReasonClientGone)
+
+	select {
+	case <-broadcast:
+	case <-time.After(time.Second):
+		t.Fatal("expected Broadcast to give up on the unregistered subscriber")
+	}
+	if stats := broadcaster.Stats(); stats.Subscribers != 0 {
+		t.Errorf("expected no subscribers but got %+v", stats)
+	}
+
+	broadcaster.UnregisterChannel(subscription, DropReasonTimeout)
+	broadcaster.Broadcast(&model.OrderEvent{Order: model.Order{OrderID: "order", IsFinal: true}})
+	select {
+	case <-subscription.channel:
+		t.Error("expected the channel of an unregistered subscriber to stay open")
+	default:
+	}
+}
+
+// TestOrderEventBroadcaster_PublishFollowsSequence publishes events of transactions out of order, subscribers get
+// them by the reserved sequence, a rolled back transaction does not hold later ones and a subscriber attached
+// after a reservation does not get the events its replay already read.
+func TestOrderEventBroadcaster_PublishFollowsSequence(t *testing.T) {
+	listener := &attachingListener{}
+	broadcaster := NewOrderEventBroadcaster(listener)
+	listener.broadcaster = broadcaster
+	event := func(id string, status model.OrderStatus) model.OrderEvent {
+		return model.OrderEvent{EventID: id, Order: model.Order{OrderID: "order", OrderStatus: status, IsFinal: model.StatusToIsFinal[status]}}
+	}
+
+	replayed := broadcaster.Reserve("order")
+	channel := make(chan *model.OrderEvent, 10)
+	<-broadcaster.RegisterChannel("order", channel).Subscribed()
+	broadcaster.Publish("order", replayed, event("1", model.StatusCoolOrderCreated))
+
+	first, rolledBack, second := broadcaster.Reserve("order"), broadcaster.Reserve("order"), broadcaster.Reserve("order")
+	broadcaster.Publish("order", second, event("3", model.StatusFailed))
+	broadcaster.Publish("order", rolledBack)
+	if len(channel) != 0 {
+		t.Fatalf("expected events to wait for the first sequence but got %d", len(channel))
+	}
+	broadcaster.Publish("order", first, event("2", model.StatusSbuVerificationPending))
+
+	var eventIds []string
+	for event := range channel {
+		eventIds = append(eventIds, event.EventID)
+	}
+	if expected := []string{"2", "3"}; !slices.Equal(eventIds, expected) {
+		t.Errorf("expected events %v but got %v", expected, eventIds)
+	}
+	if len(broadcaster.orderIdToStream) != 0 {
+		t.Errorf("expected the stream of the final order to be dropped but got %d", len(broadcaster.orderIdToStream))
+	}
+}
+
+func BenchmarkOrderEventBroadcaster_Broadcast(b *testing.B) {
+	for _, subscribers := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("%d subscribers", subscribers), func(b *testing.B) {
+			listener := &attachingListener{}
+			broadcaster := NewOrderEventBroadcaster(listener)
+			listener.broadcaster = broadcaster
+
+			var wg sync.WaitGroup
+			for i := 0; i < subscribers; i++ {
+				channel := make(chan *model.OrderEvent)
+				<-broadcaster.RegisterChannel("order", channel).Subscribed()
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range channel {
+					}
+				}()
+			}
+
+			event := &model.OrderEvent{EventID: "event", Order: model.Order{OrderID: "order", OrderStatus: model.StatusCoolOrderCreated}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				broadcaster.Broadcast(event)
+			}
+			b.StopTimer()
+
+			broadcaster.Broadcast(&model.OrderEvent{Order: model.Order{OrderID: "order", IsFinal: true}})
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkOrderEventBroadcaster_BroadcastManyOrders(b *testing.B) {
+	listener := &attachingListener{}
+	broadcaster := NewOrderEventBroadcaster(listener)
+	listener.broadcaster = broadcaster
+
+	const orders = 1000
+	events := make([]*model.OrderEvent, orders)
+	var wg sync.WaitGroup
+	for i := range events {
+		orderId := fmt.Sprintf("order-%d", i)
+		events[i] = &model.OrderEvent{Order: model.Order{OrderID: orderId, OrderStatus: model.StatusCoolOrderCreated}}
+		channel := make(chan *model.OrderEvent)
+		<-broadcaster.RegisterChannel(orderId, channel).Subscribed()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range channel {
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			broadcaster.Broadcast(events[i%orders])
+			i++
+		}
+	})
+	b.StopTimer()
+
+	for _, event := range events {
+		broadcaster.Broadcast(&model.OrderEvent{Order: model.Order{OrderID: event.OrderID, IsFinal: true}})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,221 @@
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/lib/metrics"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	bufferedOrdersMetric = metrics.NewGauge("orders_with_buffered_events",
+		"Orders with out-of-order events waiting for a predecessor, updated on every buffer check.")
+	deadLetteredEventsMetric = metrics.NewCounter("dead_lettered_order_events_total",
+		"Out-of-order events moved to the dead letter table.")
+)
+
+type Storage interface {
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	GetEventsOfOrdersWithOutOfOrderEvents(ctx context.Context) ([]model.OrderEvent, error)
+	DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (int64, error)
+}
+
+// Monitor reports orders whose events wait for a missing predecessor and, when maxWait is set,
+// dead-letters events that waited longer than maxWait.
+type Monitor struct {
+	log     *slog.Logger
+	storage Storage
+	maxWait atomic.Int64
+	clock   clock.Clock
+}
+
+func NewMonitor(log *slog.Logger, storage Storage, maxWait time.Duration, clock clock.Clock) *Monitor {
+	m := &Monitor{
+		log:     log,
+		storage: storage,
+		clock:   clock,
+	}
+	m.SetMaxWait(maxWait)
+	return m
+}
+
+func (m *Monitor) MaxWait() time.Duration {
+	return time.Duration(m.maxWait.Load())
+}
+
+// SetMaxWait applies from the next check, 0 stops dead-lettering.
+func (m *Monitor) SetMaxWait(maxWait time.Duration) {
+	m.maxWait.Store(int64(maxWait))
+}
+
+func (m *Monitor) GetBufferedOrders(ctx context.Context) ([]model.BufferedOrder, error) {
+	events, err := m.storage.GetEventsOfOrdersWithOutOfOrderEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orderIdToEvents := make(map[string][]model.OrderEvent)
+	for _, event := range events {
+		orderIdToEvents[event.OrderID] = append(orderIdToEvents[event.OrderID], event)
+	}
+
+	now := m.clock.Now()
+	bufferedOrders := make([]model.BufferedOrder, 0, len(orderIdToEvents))
+	for orderId, orderEvents := range orderIdToEvents {
+		bufferedOrder, ok := toBufferedOrder(orderId, orderEvents, now)
+		if ok {
+			bufferedOrders = append(bufferedOrders, bufferedOrder)
+		}
+	}
+	sort.Slice(bufferedOrders, func(i, j int) bool {
+		return bufferedOrders[i].WaitingSince.Before(bufferedOrders[j].WaitingSince)
+	})
+
+	bufferedOrdersMetric.Set(float64(len(bufferedOrders)))
+	return bufferedOrders, nil
+}
+
+// DeadLetterExpired moves out-of-order events received more than maxWait ago to the dead letter table.
+func (m *Monitor) DeadLetterExpired(ctx context.Context) error {
+	maxWait := m.MaxWait()
+	if maxWait <= 0 {
+		return nil
+	}
+
+	bufferedOrders, err := m.GetBufferedOrders(ctx)
+	if err != nil {
+		return err
+	}
+
+	deadline := m.clock.Now().Add(-maxWait)
+	for _, bufferedOrder := range bufferedOrders {
+		var eventIds []string
+		for _, event := range bufferedOrder.BufferedEvents {
+			if event.ReceivedAt.Before(deadline) {
+				eventIds = append(eventIds, event.EventID)
+			}
+		}
+		if len(eventIds) == 0 {
+			continue
+		}
+
+		reason := fmt.Sprintf("missing %v after waiting more than %s", bufferedOrder.MissingStatuses, maxWait)
+		var count int64
+		err := m.storage.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := m.storage.AcquireLock(ctx, bufferedOrder.OrderID); err != nil {
+				return err
+			}
+
+			count, err = m.storage.DeadLetterOrderEvents(ctx, reason, eventIds...)
+			return err
+		})
+		if err != nil {
+			m.log.Error("error while dead-lettering order events", "order_id", bufferedOrder.OrderID, "error", err)
+			continue
+		}
+		deadLetteredEventsMetric.Add(float64(count))
+		m.log.Warn("dead-lettered out of order events", "order_id", bufferedOrder.OrderID, "count", count, "reason", reason)
+	}
+
+	return nil
+}
+
+// Run checks buffered orders every interval until ctx is done, a check in progress is finished first.
+// interval is read before every wait, so a reloaded value applies after the pending wait.
+func (m *Monitor) Run(ctx context.Context, interval func() time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.clock.After(interval()):
+		}
+		var err error
+		if m.MaxWait() > 0 {
+			err = m.DeadLetterExpired(context.Background())
+		} else {
+			_, err = m.GetBufferedOrders(context.Background())
+		}
+		if err != nil {
+			m.log.Error("error while checking buffered orders", "error", err)
+		}
+	}
+}
+
+func toBufferedOrder(orderId string, orderEvents []model.OrderEvent, now time.Time) (model.BufferedOrder, bool) {
+	currentStatus := ordering.CurrentStatus(orderEvents)
+
+	var bufferedEvents []model.BufferedEvent
+	for _, event := range orderEvents {
+		if !event.InOrder {
+			bufferedEvents = append(bufferedEvents, model.BufferedEvent{
+				EventID:     event.EventID,
+				OrderStatus: event.OrderStatus,
+				UpdatedAt:   event.UpdatedAt,
+				ReceivedAt:  event.ReceivedAt,
+			})
+		}
+	}
+	if len(bufferedEvents) == 0 {
+		return model.BufferedOrder{}, false
+	}
+	sort.Slice(bufferedEvents, func(i, j int) bool {
+		return bufferedEvents[i].UpdatedAt.Before(bufferedEvents[j].UpdatedAt)
+	})
+
+	waitingSince := bufferedEvents[0].ReceivedAt
+	bufferedStatuses := make([]model.OrderStatus, 0, len(bufferedEvents))
+	for _, event := range bufferedEvents {
+		bufferedStatuses = append(bufferedStatuses, event.OrderStatus)
+		if event.ReceivedAt.Before(waitingSince) {
+			waitingSince = event.ReceivedAt
+		}
+	}
+
+	return model.BufferedOrder{
+		OrderID:         orderId,
+		CurrentStatus:   currentStatus,
+		MissingStatuses: missingStatuses(currentStatus, bufferedStatuses),
+		BufferedEvents:  bufferedEvents,
+		WaitingSince:    waitingSince,
+		WaitingSeconds:  now.Sub(waitingSince).Seconds(),
+	}, true
+}
+
+// missingStatuses returns statuses on the shortest path in model.Transitions from currentStatus to the nearest
+// buffered status. If no buffered status is reachable, every status allowed after currentStatus is missing.
+func missingStatuses(currentStatus model.OrderStatus, bufferedStatuses []model.OrderStatus) []model.OrderStatus {
+	previous := map[model.OrderStatus]model.OrderStatus{currentStatus: currentStatus}
+	queue := []model.OrderStatus{currentStatus}
+	for len(queue) > 0 {
+		status := queue[0]
+		queue = queue[1:]
+		for _, next := range model.Transitions[status] {
+			if _, visited := previous[next]; visited {
+				continue
+			}
+			previous[next] = status
+			if slices.Contains(bufferedStatuses, next) {
+				return pathTo(previous, currentStatus, status)
+			}
+			queue = append(queue, next)
+		}
+	}
+	return model.Transitions[currentStatus]
+}
+
+func pathTo(previous map[model.OrderStatus]model.OrderStatus, from model.OrderStatus, to model.OrderStatus) []model.OrderStatus {
+	path := make([]model.OrderStatus, 0)
+	for status := to; status != from; status = previous[status] {
+		path = append(path, status)
+	}
+	slices.Reverse(path)
+	return path
+}
@@ -0,0 +1,30 @@
+package buffer
+
+import (
+	"order-event-processor/internal/model"
+	"slices"
+	"testing"
+)
+
+func TestMissingStatuses(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  model.OrderStatus
+		buffered []model.OrderStatus
+		expected []model.OrderStatus
+	}{
+		{"first event missing", model.StatusInitial, []model.OrderStatus{model.StatusSbuVerificationPending}, []model.OrderStatus{model.StatusCoolOrderCreated}},
+		{"several events missing", model.StatusInitial, []model.OrderStatus{model.StatusChinazes}, []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor}},
+		{"nearest buffered status wins", model.StatusCoolOrderCreated, []model.OrderStatus{model.StatusChinazes, model.StatusConfirmedByMayor}, []model.OrderStatus{model.StatusSbuVerificationPending}},
+		{"unreachable status", model.StatusChinazes, []model.OrderStatus{model.StatusFailed}, []model.OrderStatus{model.StatusGiveMyMoneyBack}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := missingStatuses(test.current, test.buffered)
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
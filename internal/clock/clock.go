@@ -0,0 +1,19 @@
+package clock
+
+import "time"
+
+// Clock is the source of time for everything that schedules or timestamps, so tests can substitute it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,72 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake only moves when Advance is called, channels returned by After fire once the clock reaches their deadline.
+type Fake struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	deadline time.Time
+	channel  chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	channel := make(chan time.Time, 1)
+	deadline := c.now.Add(d)
+	if !deadline.After(c.now) {
+		channel <- c.now
+		return channel
+	}
+	c.waiters = append(c.waiters, waiter{deadline: deadline, channel: channel})
+	return channel
+}
+
+// Advance moves the clock forward by d and fires every waiter whose deadline has been reached.
+func (c *Fake) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.channel <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of After channels that have not fired yet.
+func (c *Fake) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n After channels are pending, so a test can advance the clock
+// only after the goroutine under test started waiting.
+func (c *Fake) BlockUntil(n int) {
+	for c.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,61 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_After(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+
+	short := clock.After(10 * time.Second)
+	long := clock.After(time.Minute)
+	clock.Advance(9 * time.Second)
+	assertNotFired(t, short)
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-short:
+		if !now.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("expected fire time %v but got %v", start.Add(10*time.Second), now)
+		}
+	default:
+		t.Error("expected short timer to fire")
+	}
+	assertNotFired(t, long)
+	if clock.Waiters() != 1 {
+		t.Errorf("expected 1 waiter but got %d", clock.Waiters())
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case <-long:
+	default:
+		t.Error("expected long timer to fire")
+	}
+	if !clock.Now().Equal(start.Add(time.Hour + 10*time.Second)) {
+		t.Errorf("unexpected now %v", clock.Now())
+	}
+}
+
+func TestFake_AfterNonPositiveDurationFiresImmediately(t *testing.T) {
+	clock := NewFake(time.Now())
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("expected timer to fire immediately")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("expected no waiters but got %d", clock.Waiters())
+	}
+}
+
+func assertNotFired(t *testing.T, channel <-chan time.Time) {
+	t.Helper()
+	select {
+	case <-channel:
+		t.Error("timer fired too early")
+	default:
+	}
+}
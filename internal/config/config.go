@@ -1,40 +1,215 @@
 package config
 
 import (
-	"github.com/ilyakaznacheev/cleanenv"
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"net/url"
+	"order-event-processor/internal/lib/logger"
+	"regexp"
+	"strconv"
+	"time"
 )
 
+// Config is read from the base file, the profile overlay and then the environment, every field has a variable.
 type Config struct {
-	Env        string `yaml:"env" env-default:"local"`
-	HTTPServer `yaml:"server"`
-	Datasource `yaml:"datasource"`
+	Env            string `yaml:"env" env:"ENV" env-default:"local"`
+	HTTPServer     `yaml:"server"`
+	Datasource     `yaml:"datasource"`
+	Stream         `yaml:"stream"`
+	Buffer         `yaml:"buffer"`
+	Projection     `yaml:"projection"`
+	Reconciliation `yaml:"reconciliation"`
+	Tracing        `yaml:"tracing"`
+	Log            `yaml:"log"`
+	Admin          `yaml:"admin"`
+}
+
+// EnvProd refuses settings meant for testing, such as storage fault injection.
+const EnvProd = "prod"
+
+func (c *Config) IsProduction() bool {
+	return c.Env == EnvProd
 }
 
 type HTTPServer struct {
-	Host string `yaml:"host"`
-	Port string `yaml:"port" env-default:"8080"`
+	Host string `yaml:"host" env:"SERVER_HOST"`
+	Port string `yaml:"port" env:"SERVER_PORT" env-default:"8080"`
+	// ShutdownTimeout bounds waiting for in-flight requests and background jobs after SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" env-default:"40s"`
 }
 
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+	DriverSqlite   = "sqlite"
+)
+
 type Datasource struct {
-	Url string `yaml:"url" env:"DATABASE_URL"`
+	Driver string `yaml:"driver" env:"DATASOURCE_DRIVER" env-default:"postgres"`
+	Url    string `yaml:"url" env:"DATABASE_URL"`
+	// AutoMigrate applies pending migrations on start, disable it when replicas start together and run cmd/migrate instead.
+	AutoMigrate bool `yaml:"auto_migrate" env:"DATASOURCE_AUTO_MIGRATE" env-default:"true"`
+}
+
+type Stream struct {
+	// Timeout ends streams that received no event for that long, clients are expected to reconnect.
+	Timeout time.Duration `yaml:"timeout" env:"STREAM_TIMEOUT" env-default:"1m"`
+}
+
+type Buffer struct {
+	CheckInterval time.Duration `yaml:"check_interval" env:"BUFFER_CHECK_INTERVAL" env-default:"1m"`
+	MaxWait       time.Duration `yaml:"max_wait" env:"BUFFER_MAX_WAIT" env-default:"0"`
+}
+
+type Projection struct {
+	BatchSize int `yaml:"batch_size" env:"PROJECTION_BATCH_SIZE" env-default:"100"`
+	Workers   int `yaml:"workers" env:"PROJECTION_WORKERS" env-default:"4"`
+}
+
+type Reconciliation struct {
+	Interval   time.Duration `yaml:"interval" env:"RECONCILIATION_INTERVAL" env-default:"5m"`
+	AutoRepair bool          `yaml:"auto_repair" env:"RECONCILIATION_AUTO_REPAIR" env-default:"false"`
 }
 
-func ReadConfig(configPath string) *Config {
-	if configPath == "" {
-		log.Fatal("configPath is not set")
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+	TracingExporterOtlp   = "otlp"
+)
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// File receives spans as JSON lines with the file exporter.
+	File string `yaml:"file" env:"TRACING_FILE" env-default:"traces.jsonl"`
+	// Endpoint is the OTLP/HTTP URL, when empty the OTEL_EXPORTER_OTLP_* variables apply.
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" env-default:"order-event-processor"`
+}
+
+type Log struct {
+	// Level is a slog level name such as debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL" env-default:"info"`
+	// Format is json or text.
+	Format string `yaml:"format" env:"LOG_FORMAT" env-default:"json"`
+}
+
+// Admin guards the /admin endpoints, which change orders, projections and the storage.
+type Admin struct {
+	// Token is expected as "Authorization: Bearer <token>" by the /admin endpoints, without it they reject every request.
+	Token string `yaml:"token" env:"ADMIN_TOKEN"`
+	// FaultInjection wraps the storage to fail or delay calls configured through /admin/faults, it is meant for testing.
+	FaultInjection bool `yaml:"fault_injection" env:"ADMIN_FAULT_INJECTION" env-default:"false"`
+}
+
+// Validate reports every invalid field at once, each error names the yaml key and the variable overriding it.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, env, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s (%s): %s", key, env, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Env == "" {
+		invalid("env", "ENV", "must not be empty")
+	}
+
+	if port, err := strconv.Atoi(c.HTTPServer.Port); err != nil || port < 1 || port > 65535 {
+		invalid("server.port", "SERVER_PORT", "%q is not a port number", c.HTTPServer.Port)
+	}
+	if c.HTTPServer.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT", "must be positive, got %s", c.HTTPServer.ShutdownTimeout)
 	}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file does not exist: %s", configPath)
+	switch c.Datasource.Driver {
+	case DriverPostgres, DriverSqlite:
+		if c.Datasource.Url == "" {
+			invalid("datasource.url", "DATABASE_URL", "is required by the %s driver", c.Datasource.Driver)
+		}
+	case DriverMemory:
+	default:
+		invalid("datasource.driver", "DATASOURCE_DRIVER", "unknown driver %q, expected %s, %s or %s",
+			c.Datasource.Driver, DriverPostgres, DriverSqlite, DriverMemory)
 	}
 
-	var cfg Config
+	if c.Stream.Timeout <= 0 {
+		invalid("stream.timeout", "STREAM_TIMEOUT", "must be positive, got %s", c.Stream.Timeout)
+	}
 
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+	if c.Buffer.CheckInterval <= 0 {
+		invalid("buffer.check_interval", "BUFFER_CHECK_INTERVAL", "must be positive, got %s", c.Buffer.CheckInterval)
+	}
+	if c.Buffer.MaxWait < 0 {
+		invalid("buffer.max_wait", "BUFFER_MAX_WAIT", "must not be negative, got %s", c.Buffer.MaxWait)
 	}
 
-	return &cfg
+	if c.Projection.BatchSize <= 0 {
+		invalid("projection.batch_size", "PROJECTION_BATCH_SIZE", "must be positive, got %d", c.Projection.BatchSize)
+	}
+	if c.Projection.Workers <= 0 {
+		invalid("projection.workers", "PROJECTION_WORKERS", "must be positive, got %d", c.Projection.Workers)
+	}
+
+	if c.Reconciliation.Interval <= 0 {
+		invalid("reconciliation.interval", "RECONCILIATION_INTERVAL", "must be positive, got %s", c.Reconciliation.Interval)
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOtlp:
+	case TracingExporterFile:
+		if c.Tracing.File == "" {
+			invalid("tracing.file", "TRACING_FILE", "is required by the file exporter")
+		}
+	default:
+		invalid("tracing.exporter", "TRACING_EXPORTER", "unknown exporter %q, expected %s, %s, %s or %s",
+			c.Tracing.Exporter, TracingExporterNone, TracingExporterStdout, TracingExporterFile, TracingExporterOtlp)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.ServiceName == "" {
+		invalid("tracing.service_name", "TRACING_SERVICE_NAME", "must not be empty")
+	}
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "LOG_LEVEL", "unknown level %q", c.Log.Level)
+	}
+	if c.Log.Format != logger.FormatJSON && c.Log.Format != logger.FormatText {
+		invalid("log.format", "LOG_FORMAT", "unknown format %q, expected %s or %s", c.Log.Format, logger.FormatJSON, logger.FormatText)
+	}
+
+	if c.Admin.FaultInjection && c.IsProduction() {
+		invalid("admin.fault_injection", "ADMIN_FAULT_INJECTION", "must not be enabled in %s", EnvProd)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy safe to print, passwords in the datasource and tracing URLs and the admin token are masked.
+func (c Config) Redacted() Config {
+	c.Datasource.Url = redact(c.Datasource.Url)
+	c.Tracing.Endpoint = redact(c.Tracing.Endpoint)
+	if c.Admin.Token != "" {
+		c.Admin.Token = redactedPassword
+	}
+	return c
+}
+
+const redactedPassword = "xxxxx"
+
+// dsnPassword matches the password of key/value connection strings, such as "host=db password=secret".
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redact(value string) string {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedPassword)
+		}
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", redactedPassword)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(value, "${1}"+redactedPassword)
 }
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPath    = "./config/base.yaml"
+	DefaultProfile = "local"
+)
+
+// Source locates the config: the base file and the overlay of a profile, <profile>.yaml next to the base file.
+type Source struct {
+	Path    string
+	Profile string
+}
+
+// RegisterFlags adds -config and -profile to fs, they default to CONFIG_PATH and CONFIG_PROFILE when those are set.
+func (s *Source) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.Path, "config", envOr("CONFIG_PATH", DefaultPath), "path to the base config file, env CONFIG_PATH")
+	fs.StringVar(&s.Profile, "profile", envOr("CONFIG_PROFILE", DefaultProfile),
+		"profile whose <profile>.yaml next to the base file overrides it, empty for none, env CONFIG_PROFILE")
+}
+
+// Files returns the files read by Load in the order they are applied.
+func (s Source) Files() ([]string, error) {
+	if s.Path == "" {
+		return nil, errors.New("config path is not set")
+	}
+	files := []string{s.Path}
+	if s.Profile == "" {
+		return files, nil
+	}
+	if strings.ContainsAny(s.Profile, `/\`) || s.Profile == "." || s.Profile == ".." {
+		return nil, fmt.Errorf("invalid profile %q, expected a file name without extension", s.Profile)
+	}
+	return append(files, filepath.Join(filepath.Dir(s.Path), s.Profile+".yaml")), nil
+}
+
+// Load starts from the env-default tags, overlays the base file, the profile file and the environment variables
+// named by the env tags and validates the result. Keys missing from a file keep their previous values, values set
+// to zero in a file stay zero.
+func Load(source Source) (*Config, error) {
+	files, err := source.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := setFields(reflect.ValueOf(&cfg).Elem(), "", defaultValue); err != nil {
+		return nil, fmt.Errorf("invalid config default: %w", err)
+	}
+	for _, file := range files {
+		if err := readFile(file, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := setFields(reflect.ValueOf(&cfg).Elem(), "", envValue); err != nil {
+		return nil, fmt.Errorf("cannot read config from environment: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return &cfg, nil
+}
+
+// readFile decodes file over cfg, unknown keys are rejected so that typos do not silently fall back to defaults.
+func readFile(file string, cfg *Config) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("cannot open config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("cannot parse config file %s: %w", file, err)
+	}
+	return nil
+}
+
+func defaultValue(field reflect.StructField) (string, bool) {
+	return field.Tag.Lookup("env-default")
+}
+
+func envValue(field reflect.StructField) (string, bool) {
+	name, ok := field.Tag.Lookup("env")
+	if !ok {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// setFields sets the fields of the struct v for which lookup finds a value, nested structs included.
+// Errors name the yaml key, prefixed with prefix, and the variable of the field.
+func setFields(v reflect.Value, prefix string, lookup func(field reflect.StructField) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		key := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if value.Kind() == reflect.Struct {
+			if err := setFields(value, key+".", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := lookup(field)
+		if !ok {
+			continue
+		}
+		if err := setField(value, raw); err != nil {
+			return fmt.Errorf("%s (%s): cannot parse %q: %w", key, field.Tag.Get("env"), raw, err)
+		}
+	}
+	return nil
+}
+
+func setField(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(parsed))
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+func envOr(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// reloadable lists the values applied without a restart, the others take effect on the next start.
+var reloadable = map[string]func(dst, src *Config){
+	"log.level":                  func(dst, src *Config) { dst.Log.Level = src.Log.Level },
+	"stream.timeout":             func(dst, src *Config) { dst.Stream.Timeout = src.Stream.Timeout },
+	"buffer.check_interval":      func(dst, src *Config) { dst.Buffer.CheckInterval = src.Buffer.CheckInterval },
+	"buffer.max_wait":            func(dst, src *Config) { dst.Buffer.MaxWait = src.Buffer.MaxWait },
+	"reconciliation.interval":    func(dst, src *Config) { dst.Reconciliation.Interval = src.Reconciliation.Interval },
+	"reconciliation.auto_repair": func(dst, src *Config) { dst.Reconciliation.AutoRepair = src.Reconciliation.AutoRepair },
+}
+
+// Change is a value that differs between two configs, secrets are redacted.
+type Change struct {
+	Key        string
+	Old        string
+	New        string
+	Reloadable bool
+}
+
+// Diff lists the values of next that differ from c, keyed like the yaml file.
+func (c *Config) Diff(next *Config) []Change {
+	var changes []Change
+	diff(reflect.ValueOf(c.Redacted()), reflect.ValueOf(next.Redacted()), "", &changes)
+	return changes
+}
+
+func diff(old, next reflect.Value, prefix string, changes *[]Change) {
+	for i := 0; i < old.NumField(); i++ {
+		key := prefix + strings.Split(old.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if old.Field(i).Kind() == reflect.Struct {
+			diff(old.Field(i), next.Field(i), key+".", changes)
+			continue
+		}
+		if old.Field(i).Equal(next.Field(i)) {
+			continue
+		}
+		_, ok := reloadable[key]
+		*changes = append(*changes, Change{
+			Key:        key,
+			Old:        fmt.Sprint(old.Field(i).Interface()),
+			New:        fmt.Sprint(next.Field(i).Interface()),
+			Reloadable: ok,
+		})
+	}
+}
+
+// Reload returns a copy of c with the reloadable values of next.
+func (c *Config) Reload(next *Config) *Config {
+	reloaded := *c
+	for _, apply := range reloadable {
+		apply(&reloaded, next)
+	}
+	return &reloaded
+}
+
+// Watch calls changed when the modification time or size of one of files changes, it polls every interval
+// until ctx is done. Polling follows the symlinks swapped by Kubernetes when a ConfigMap is updated.
+func Watch(ctx context.Context, files []string, interval time.Duration, changed func()) {
+	stamps := make([]string, len(files))
+	for i, file := range files {
+		stamps[i] = stamp(file)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modified := false
+		for i, file := range files {
+			if current := stamp(file); current != stamps[i] {
+				stamps[i] = current
+				modified = true
+			}
+		}
+		if modified {
+			changed()
+		}
+	}
+}
+
+// stamp is empty for files that cannot be read, a reload triggered while a file is missing fails to load it.
+func stamp(file string) string {
+	info, err := os.Stat(file)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
@@ -0,0 +1,79 @@
+// Package datasource opens the storage selected by datasource.driver for the commands sharing it.
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"log/slog"
+	"order-event-processor/internal/app"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/health"
+	"order-event-processor/internal/migration"
+	"order-event-processor/internal/storage/memory"
+	"order-event-processor/internal/storage/postgresql"
+	"order-event-processor/internal/storage/sqlite"
+)
+
+// Open also returns a readiness check of the migrations, it is nil for storages without migrations.
+func Open(log *slog.Logger, datasource config.Datasource) (app.Storage, health.CheckFunc, func(), error) {
+	switch datasource.Driver {
+	case config.DriverPostgres:
+		return newPostgresStorage(log, datasource)
+	case config.DriverSqlite:
+		return newSqliteStorage(log, datasource)
+	case config.DriverMemory:
+		log.Warn("using in-memory storage, data is lost on restart")
+		return memory.New(), nil, func() {}, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown datasource driver %q", datasource.Driver)
+	}
+}
+
+func newPostgresStorage(log *slog.Logger, datasource config.Datasource) (app.Storage, health.CheckFunc, func(), error) {
+	dbpool, err := pgxpool.New(context.Background(), datasource.Url)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	check, err := migrate(log, datasource, stdlib.OpenDBFromPool(dbpool))
+	if err != nil {
+		dbpool.Close()
+		return nil, nil, nil, err
+	}
+	return postgresql.New(dbpool), check, dbpool.Close, nil
+}
+
+func newSqliteStorage(log *slog.Logger, datasource config.Datasource) (app.Storage, health.CheckFunc, func(), error) {
+	db, err := sqlite.Open(datasource.Url)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	check, err := migrate(log, datasource, db)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	return sqlite.New(db), check, func() { db.Close() }, nil
+}
+
+// migrate applies pending migrations unless auto migration is disabled, then the server stays unready
+// until cmd/migrate brings the database to the latest version.
+func migrate(log *slog.Logger, datasource config.Datasource, db *sql.DB) (health.CheckFunc, error) {
+	migrator, err := migration.New(log, datasource.Driver, db)
+	if err != nil {
+		return nil, err
+	}
+	if !datasource.AutoMigrate {
+		log.Info("automatic migrations are disabled", "latest_version", migrator.Latest())
+		return migrator.Check, nil
+	}
+	if err := migrator.Up(); err != nil {
+		return nil, fmt.Errorf("unable to apply migrations: %w", err)
+	}
+	log.Info("migration completed successfully")
+	return migrator.Check, nil
+}
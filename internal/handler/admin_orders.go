@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/admin"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage"
+)
+
+type OrderRepairer interface {
+	Timeline(ctx context.Context, orderId string) (model.OrderTimeline, error)
+	Reorder(ctx context.Context, orderId string, operator model.OperatorAction) (model.OrderTimeline, error)
+	Finalize(ctx context.Context, orderId string, operator model.OperatorAction) (model.OrderTimeline, error)
+	Transition(ctx context.Context, orderId string, status model.OrderStatus, force bool, operator model.OperatorAction) (model.OrderTimeline, error)
+	DeleteEvent(ctx context.Context, orderId string, eventId string, operator model.OperatorAction) (model.OrderTimeline, error)
+	AuditLog(ctx context.Context, orderId string) ([]model.AuditEntry, error)
+}
+
+// AdminOrdersHandler lets support engineers inspect and repair single orders, every change names an operator
+// and a reason which end up in the audit log.
+type AdminOrdersHandler struct {
+	log      *slog.Logger
+	validate *validator.Validate
+	repairer OrderRepairer
+}
+
+func NewAdminOrdersHandler(log *slog.Logger, validate *validator.Validate, repairer OrderRepairer) *AdminOrdersHandler {
+	return &AdminOrdersHandler{
+		log:      log,
+		validate: validate,
+		repairer: repairer,
+	}
+}
+
+// GetTimeline returns the orders row with the in order and buffered events of the order.
+func (h *AdminOrdersHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	timeline, err := h.repairer.Timeline(r.Context(), orderId)
+	h.writeTimeline(w, r, timeline, err)
+}
+
+// Reorder recomputes which events of the order are in order.
+func (h *AdminOrdersHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	var operator model.OperatorAction
+	if !h.decode(w, r, &operator) {
+		return
+	}
+	timeline, err := h.repairer.Reorder(r.Context(), orderId, operator)
+	h.writeTimeline(w, r, timeline, err)
+}
+
+// Finalize makes the last in order event of the order final.
+func (h *AdminOrdersHandler) Finalize(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	var operator model.OperatorAction
+	if !h.decode(w, r, &operator) {
+		return
+	}
+	timeline, err := h.repairer.Finalize(r.Context(), orderId, operator)
+	h.writeTimeline(w, r, timeline, err)
+}
+
+// Transition moves the order to the status in the body, it must be allowed after the current status
+// unless force is set.
+func (h *AdminOrdersHandler) Transition(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	var request model.TransitionRequest
+	if !h.decode(w, r, &request) {
+		return
+	}
+	timeline, err := h.repairer.Transition(r.Context(), orderId, request.Status, request.Force, request.OperatorAction)
+	h.writeTimeline(w, r, timeline, err)
+}
+
+// DeleteEvent removes a bogus event of the order, the operator and reason are read from the body.
+func (h *AdminOrdersHandler) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	orderId, eventId := r.PathValue("order_id"), r.PathValue("event_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId, "event_id", eventId)
+	var operator model.OperatorAction
+	if !h.decode(w, r, &operator) {
+		return
+	}
+	timeline, err := h.repairer.DeleteEvent(r.Context(), orderId, eventId, operator)
+	h.writeTimeline(w, r, timeline, err)
+}
+
+// GetAuditLog returns the manual changes made to the order, oldest first.
+func (h *AdminOrdersHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	log := logger.FromContext(r.Context(), h.log)
+	entries, err := h.repairer.AuditLog(r.Context(), orderId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while getting audit log", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, entries); err != nil {
+		log.Error("error while writing audit log", "error", err)
+	}
+}
+
+// decode reads and validates the body into v, it answers with 400 and returns false if that fails.
+func (h *AdminOrdersHandler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	log := logger.FromContext(r.Context(), h.log)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("failed to decode admin request", "error", err)
+		return false
+	}
+	if err := h.validate.Struct(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("validation error", "error", err)
+		return false
+	}
+	return true
+}
+
+func (h *AdminOrdersHandler) writeTimeline(w http.ResponseWriter, r *http.Request, timeline model.OrderTimeline, err error) {
+	log := logger.FromContext(r.Context(), h.log)
+	switch {
+	case err == nil:
+		if err = httputil.WriteJSON(w, timeline); err != nil {
+			log.Error("error while writing order timeline", "error", err)
+		}
+	case errors.Is(err, storage.OrderNotFound), errors.Is(err, storage.EventNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, admin.ErrUnknownStatus):
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("invalid order status", "error", err)
+	case errors.Is(err, admin.ErrOrderFinal), errors.Is(err, admin.ErrNoInOrderEvents), errors.Is(err, admin.ErrUnorderable),
+		errors.Is(err, admin.ErrInvalidTransition):
+		w.WriteHeader(http.StatusConflict)
+		log.Warn("order cannot be changed", "error", err)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while changing order", "error", err)
+	}
+}
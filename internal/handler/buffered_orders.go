@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+)
+
+type BufferedOrdersFinder interface {
+	GetBufferedOrders(ctx context.Context) ([]model.BufferedOrder, error)
+}
+
+type BufferedOrdersHandler struct {
+	log    *slog.Logger
+	finder BufferedOrdersFinder
+}
+
+func NewBufferedOrdersHandler(log *slog.Logger, finder BufferedOrdersFinder) *BufferedOrdersHandler {
+	return &BufferedOrdersHandler{
+		log:    log,
+		finder: finder,
+	}
+}
+
+func (h *BufferedOrdersHandler) GetBufferedOrders(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	bufferedOrders, err := h.finder.GetBufferedOrders(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while getting buffered orders", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, bufferedOrders); err != nil {
+		log.Error("error while writing buffered orders", "error", err)
+		return
+	}
+}
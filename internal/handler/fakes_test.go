@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"order-event-processor/internal/model"
+	"sync"
+)
+
+var errStorage = errors.New("storage unavailable")
+
+// fakeRepository serves events and flags set by a test, errs fails the named method. Writes are recorded
+// and discarded when the transaction fails, like a rollback would.
+type fakeRepository struct {
+	mutex sync.Mutex
+
+	events      []model.OrderEvent
+	eventExists bool
+	finalExists bool
+	moneyBack   bool
+	errs        map[string]error
+	commitErr   error
+
+	inserted []model.OrderEvent
+	orders   []model.Order
+	finalIds []string
+
+	txInserted []model.OrderEvent
+	txOrders   []model.Order
+	txFinalIds []string
+}
+
+func (r *fakeRepository) err(method string) error {
+	return r.errs[method]
+}
+
+func (r *fakeRepository) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.err("RunInTransaction"); err != nil {
+		return err
+	}
+	r.txInserted, r.txOrders, r.txFinalIds = nil, nil, nil
+	if err := run(ctx); err != nil {
+		return err
+	}
+	if r.commitErr != nil {
+		return r.commitErr
+	}
+	r.inserted = append(r.inserted, r.txInserted...)
+	r.orders = append(r.orders, r.txOrders...)
+	r.finalIds = append(r.finalIds, r.txFinalIds...)
+	return nil
+}
+
+func (r *fakeRepository) AcquireLock(_ context.Context, _ string) error {
+	return r.err("AcquireLock")
+}
+
+func (r *fakeRepository) SaveOrderEvent(_ context.Context, event model.OrderEvent) error {
+	if err := r.err("SaveOrderEvent"); err != nil {
+		return err
+	}
+	r.txInserted = append(r.txInserted, event)
+	return nil
+}
+
+func (r *fakeRepository) InsertOrderEventsOrUpdateIsInOrder(_ context.Context, events ...model.OrderEvent) error {
+	if err := r.err("InsertOrderEventsOrUpdateIsInOrder"); err != nil {
+		return err
+	}
+	r.txInserted = append(r.txInserted, events...)
+	return nil
+}
+
+func (r *fakeRepository) GetAllEventsByOrderId(_ context.Context, _ string) ([]model.OrderEvent, error) {
+	if err := r.err("GetAllEventsByOrderId"); err != nil {
+		return nil, err
+	}
+	events := make([]model.OrderEvent, len(r.events))
+	copy(events, r.events)
+	return events, nil
+}
+
+func (r *fakeRepository) ExistsOrderEventForOrderIdFinalAndInOrder(_ context.Context, _ string) (bool, error) {
+	return r.finalExists, r.err("ExistsOrderEventForOrderIdFinalAndInOrder")
+}
+
+func (r *fakeRepository) ExistsOrderEventWithEventId(_ context.Context, _ string) (bool, error) {
+	return r.eventExists, r.err("ExistsOrderEventWithEventId")
+}
+
+func (r *fakeRepository) ExistsOrderEventForOrderIdWithStatus(_ context.Context, _ string, _ model.OrderStatus) (bool, error) {
+	return r.moneyBack, r.err("ExistsOrderEventForOrderIdWithStatus")
+}
+
+func (r *fakeRepository) UpdateOrderEventFinalStatus(_ context.Context, eventId string) error {
+	if err := r.err("UpdateOrderEventFinalStatus"); err != nil {
+		return err
+	}
+	r.txFinalIds = append(r.txFinalIds, eventId)
+	return nil
+}
+
+func (r *fakeRepository) InsertOrUpdateOrder(_ context.Context, order model.Order) error {
+	if err := r.err("InsertOrUpdateOrder"); err != nil {
+		return err
+	}
+	r.txOrders = append(r.txOrders, order)
+	return nil
+}
+
+// fakeBroadcaster records published events and how many sequences were reserved and published.
+type fakeBroadcaster struct {
+	mutex     sync.Mutex
+	events    []model.OrderEvent
+	reserved  uint64
+	published int
+}
+
+func (b *fakeBroadcaster) Reserve(_ string) uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.reserved++
+	return b.reserved
+}
+
+func (b *fakeBroadcaster) Publish(_ string, _ uint64, events ...model.OrderEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.published++
+	b.events = append(b.events, events...)
+}
+
+func (b *fakeBroadcaster) eventIds() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	ids := make([]string, 0, len(b.events))
+	for _, event := range b.events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+)
+
+type FaultInjector interface {
+	Faults() []model.StorageFault
+	SetFaults(faults []model.StorageFault) error
+}
+
+type FaultsHandler struct {
+	log      *slog.Logger
+	validate *validator.Validate
+	injector FaultInjector
+}
+
+func NewFaultsHandler(log *slog.Logger, validate *validator.Validate, injector FaultInjector) *FaultsHandler {
+	return &FaultsHandler{
+		log:      log,
+		validate: validate,
+		injector: injector,
+	}
+}
+
+func (h *FaultsHandler) GetFaults(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	if err := httputil.WriteJSON(w, h.injector.Faults()); err != nil {
+		log.Error("error while writing storage faults", "error", err)
+	}
+}
+
+// SetFaults replaces all storage faults with the faults in the body.
+func (h *FaultsHandler) SetFaults(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	var faults []model.StorageFault
+	if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("failed to decode storage faults", "error", err)
+		return
+	}
+	for _, fault := range faults {
+		if err := h.validate.Struct(fault); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error("validation error", "error", err)
+			return
+		}
+	}
+
+	if err := h.injector.SetFaults(faults); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("invalid storage faults", "error", err)
+		return
+	}
+	log.Warn("set storage faults", "faults", faults)
+
+	if err := httputil.WriteJSON(w, h.injector.Faults()); err != nil {
+		log.Error("error while writing storage faults", "error", err)
+	}
+}
+
+func (h *FaultsHandler) ClearFaults(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	if err := h.injector.SetFaults(nil); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while clearing storage faults", "error", err)
+		return
+	}
+	log.Warn("cleared storage faults")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+)
+
+type ReadinessChecker interface {
+	CheckReadiness(ctx context.Context) model.Readiness
+}
+
+type StatusProvider interface {
+	Status(ctx context.Context) (model.ServerStatus, error)
+}
+
+// PoolStatsProvider is implemented by storages backed by a connection pool.
+type PoolStatsProvider interface {
+	PoolStats() model.PoolStats
+}
+
+type HealthHandler struct {
+	log      *slog.Logger
+	checker  ReadinessChecker
+	provider StatusProvider
+}
+
+func NewHealthHandler(log *slog.Logger, checker ReadinessChecker, provider StatusProvider) *HealthHandler {
+	return &HealthHandler{
+		log:      log,
+		checker:  checker,
+		provider: provider,
+	}
+}
+
+// Healthz answers as long as the process serves requests, it checks no dependencies.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	if err := httputil.WriteJSON(w, map[string]string{"status": "ok"}); err != nil {
+		log.Error("error while writing health", "error", err)
+	}
+}
+
+// Readyz answers 503 with the failed checks while the server should not get traffic.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	readiness := h.checker.CheckReadiness(r.Context())
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+		log.Warn("not ready", "checks", readiness.Checks)
+	}
+	if err := httputil.WriteJSONWithStatus(w, status, readiness); err != nil {
+		log.Error("error while writing readiness", "error", err)
+	}
+}
+
+func (h *HealthHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	status, err := h.provider.Status(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while getting server status", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, status); err != nil {
+		log.Error("error while writing server status", "error", err)
+	}
+}
@@ -6,24 +6,38 @@ import (
 	"log/slog"
 	"net/http"
 	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/lib/logger"
 	"order-event-processor/internal/model"
+	"sync/atomic"
 	"time"
 )
 
 type OrderEventStreamHandler struct {
 	log         *slog.Logger
 	broadcaster *broadcaster.OrderEventBroadcaster
+	clock       clock.Clock
+	timeout     atomic.Int64
 }
 
-func NewOrderEventStreamHandler(log *slog.Logger, b *broadcaster.OrderEventBroadcaster) *OrderEventStreamHandler {
-	return &OrderEventStreamHandler{
+func NewOrderEventStreamHandler(log *slog.Logger, b *broadcaster.OrderEventBroadcaster, clock clock.Clock, timeout time.Duration) *OrderEventStreamHandler {
+	h := &OrderEventStreamHandler{
 		log:         log,
 		broadcaster: b,
+		clock:       clock,
 	}
+	h.SetTimeout(timeout)
+	return h
+}
+
+// SetTimeout changes how long streams may go without an event, open streams apply it after their next event.
+func (h *OrderEventStreamHandler) SetTimeout(timeout time.Duration) {
+	h.timeout.Store(int64(timeout))
 }
 
 func (h *OrderEventStreamHandler) StreamOrderEvents(w http.ResponseWriter, r *http.Request) {
 	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
 
 	// Set headers for SSE
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -32,10 +46,16 @@ func (h *OrderEventStreamHandler) StreamOrderEvents(w http.ResponseWriter, r *ht
 	w.(http.Flusher).Flush()
 
 	channel := make(chan *model.OrderEvent)
-	h.broadcaster.RegisterChannel(orderId, channel)
+	subscription := h.broadcaster.RegisterChannel(orderId, channel)
+	subscribed := subscription.Subscribed()
 
 	for {
 		select {
+		case <-subscribed:
+			// an SSE comment, clients ignore it, tests wait for it before triggering new events
+			fmt.Fprint(w, ": subscribed\n\n")
+			w.(http.Flusher).Flush()
+			subscribed = nil
 		case event, ok := <-channel:
 			if !ok {
 				return
@@ -46,8 +66,20 @@ func (h *OrderEventStreamHandler) StreamOrderEvents(w http.ResponseWriter, r *ht
 			}
 			fmt.Fprintf(w, "data: %s\n\n", string(jsonData))
 			w.(http.Flusher).Flush()
-		case <-time.After(1 * time.Minute):
-			h.broadcaster.UnregisterChannel(orderId, channel)
+		case <-subscription.Done():
+			// the replay failed and unregistered the subscription
+			return
+		case <-h.clock.After(time.Duration(h.timeout.Load())):
+			h.broadcaster.UnregisterChannel(subscription, broadcaster.DropReasonTimeout)
+			return
+		case <-h.broadcaster.Done():
+			// lets clients tell a deploy from a final event and reconnect to another instance
+			fmt.Fprint(w, "event: shutdown\ndata: server is shutting down\n\n")
+			w.(http.Flusher).Flush()
+			h.broadcaster.UnregisterChannel(subscription, broadcaster.DropReasonShutdown)
+			return
+		case <-r.Context().Done():
+			h.broadcaster.UnregisterChannel(subscription, broadcaster.DropReasonClientGone)
 			return
 		}
 	}
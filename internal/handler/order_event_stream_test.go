@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/clock"
+	loggerhandler "order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/model"
+	"testing"
+	"time"
+)
+
+// blockingRepository holds the replay until release is closed and closes replayed once its transaction ends.
+type blockingRepository struct {
+	*fakeRepository
+	release  chan struct{}
+	replayed chan struct{}
+}
+
+func (r *blockingRepository) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	defer close(r.replayed)
+	return r.fakeRepository.RunInTransaction(ctx, run)
+}
+
+func (r *blockingRepository) GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error) {
+	<-r.release
+	return r.fakeRepository.GetAllEventsByOrderId(ctx, orderId)
+}
+
+// TestOrderEventStreamHandler_CancelDuringReplay ends the request while past events are being replayed,
+// the replay must stop sending without attaching the stream to the broadcaster.
+func TestOrderEventStreamHandler_CancelDuringReplay(t *testing.T) {
+	at := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []model.OrderEvent
+	for i, status := range []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor} {
+		events = append(events, model.OrderEvent{
+			EventID: string(status),
+			Order:   model.Order{OrderID: "order", OrderStatus: status, UpdatedAt: at.Add(time.Duration(i) * time.Minute), CreatedAt: at},
+			InOrder: true,
+		})
+	}
+	repository := &blockingRepository{
+		fakeRepository: &fakeRepository{events: events},
+		release:        make(chan struct{}),
+		replayed:       make(chan struct{}),
+	}
+	producer := broadcaster.NewFromDbEventProducer(repository)
+	b := broadcaster.NewOrderEventBroadcaster(producer)
+	producer.OrderEventBroadcaster = b
+	handler := NewOrderEventStreamHandler(slog.New(loggerhandler.NewNoOpHandler()), b, clock.NewFake(at), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := httptest.NewRequest("GET", "/orders/order/events", nil).WithContext(ctx)
+	request.SetPathValue("order_id", "order")
+	served := make(chan struct{})
+	go func() {
+		handler.StreamOrderEvents(httptest.NewRecorder(), request)
+		close(served)
+	}()
+
+	cancel()
+	<-served
+	close(repository.release)
+
+	select {
+	case <-repository.replayed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the replay to stop once the request was cancelled")
+	}
+	if stats := b.Stats(); stats.Subscribers != 0 {
+		t.Errorf("expected the cancelled stream not to be attached but got %+v", stats)
+	}
+}
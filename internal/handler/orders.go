@@ -1,14 +1,21 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
 	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage"
+	"time"
 )
 
 type OrdersFinder interface {
-	GetAllOrders() ([]model.Order, error)
+	GetAllOrders(ctx context.Context) ([]model.Order, error)
+	GetOrder(ctx context.Context, orderId string) (model.Order, error)
+	GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (model.OrderState, error)
 }
 
 type OrdersHandler struct {
@@ -23,16 +30,75 @@ func NewOrdersHandler(log *slog.Logger, finder OrdersFinder) *OrdersHandler {
 	}
 }
 
-func (h *OrdersHandler) GetAllOrders(w http.ResponseWriter, _ *http.Request) {
-	orders, err := h.finder.GetAllOrders()
+func (h *OrdersHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	orders, err := h.finder.GetAllOrders(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		h.log.Error("error while getting broadcaster", "error", err)
+		log.Error("error while getting broadcaster", "error", err)
 		return
 	}
 
 	if err = httputil.WriteJSON(w, orders); err != nil {
-		h.log.Error("error while writing orders", "error", err)
+		log.Error("error while writing orders", "error", err)
+		return
+	}
+}
+
+// GetOrder returns the current order projection or, when as_of is set, the order state at that moment.
+// The by parameter selects whether as_of is compared with updated_at (default) or received_at of events.
+func (h *OrdersHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	orderId := r.PathValue("order_id")
+	logger.AddAttrs(r.Context(), "order_id", orderId)
+	log := logger.FromContext(r.Context(), h.log)
+
+	rawAsOf := r.URL.Query().Get("as_of")
+	if rawAsOf == "" {
+		order, err := h.finder.GetOrder(r.Context(), orderId)
+		if errors.Is(err, storage.OrderNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error("error while getting order", "error", err)
+			return
+		}
+
+		if err = httputil.WriteJSON(w, model.OrderState{Order: order, IsFinal: order.IsFinal, AsOf: order.UpdatedAt, Timeline: model.TimelineUpdatedAt}); err != nil {
+			log.Error("error while writing order", "error", err)
+		}
+		return
+	}
+
+	asOf, err := time.Parse(time.RFC3339Nano, rawAsOf)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("invalid as_of parameter", "error", err)
+		return
+	}
+
+	timeline := model.TimelineUpdatedAt
+	if by := r.URL.Query().Get("by"); by != "" {
+		timeline = model.Timeline(by)
+	}
+	if timeline != model.TimelineUpdatedAt && timeline != model.TimelineReceivedAt {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Error("invalid by parameter", "by", timeline)
+		return
+	}
+
+	state, err := h.finder.GetOrderAsOf(r.Context(), orderId, asOf, timeline)
+	if errors.Is(err, storage.OrderNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while getting order state", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, state); err != nil {
+		log.Error("error while writing order state", "error", err)
 		return
 	}
 }
@@ -1,127 +1,269 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
 	"net/http"
-	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/lib/metrics"
 	"order-event-processor/internal/model"
-	"slices"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/tracing"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type OrderEventRepository interface {
-	SaveOrderEvent(event model.OrderEvent) error
-	InsertOrderEventsOrUpdateIsInOrder(events ...model.OrderEvent) error
-	GetAllEventsByOrderId(orderId string) ([]model.OrderEvent, error)
-	RunInTransaction(run func()) error
-	AcquireLock(id string) error
-	ExistsOrderEventForOrderIdFinalAndInOrder(orderId string) (bool, error)
-	ExistsOrderEventWithEventId(eventId string) (bool, error)
-	ExistsOrderEventForOrderIdWithStatus(orderId string, orderStatus model.OrderStatus) (bool, error)
-	UpdateOrderEventFinalStatus(eventId string) error
-	InsertOrUpdateOrder(order model.Order) error
+	SaveOrderEvent(ctx context.Context, event model.OrderEvent) error
+	InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, events ...model.OrderEvent) error
+	GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error)
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	ExistsOrderEventForOrderIdFinalAndInOrder(ctx context.Context, orderId string) (bool, error)
+	ExistsOrderEventWithEventId(ctx context.Context, eventId string) (bool, error)
+	ExistsOrderEventForOrderIdWithStatus(ctx context.Context, orderId string, orderStatus model.OrderStatus) (bool, error)
+	UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error
+	InsertOrUpdateOrder(ctx context.Context, order model.Order) error
+}
+
+// OrderEventBroadcaster delivers events once their transaction ended, a sequence is reserved under the order lock
+// so that subscribers receive events in the order they were committed.
+type OrderEventBroadcaster interface {
+	Reserve(orderId string) uint64
+	Publish(orderId string, sequence uint64, events ...model.OrderEvent)
 }
 
 type PaymentSystemEventHandler struct {
 	log         *slog.Logger
 	validate    *validator.Validate
 	repository  OrderEventRepository
-	broadcaster *broadcaster.OrderEventBroadcaster
+	broadcaster OrderEventBroadcaster
+	clock       clock.Clock
+	jobs        sync.WaitGroup
+	pendingMu   sync.Mutex
+	pending     map[string]struct{}
 }
 
-func NewPaymentSystemEventHandler(log *slog.Logger, validate *validator.Validate, repository OrderEventRepository, broadcaster *broadcaster.OrderEventBroadcaster) *PaymentSystemEventHandler {
+func NewPaymentSystemEventHandler(log *slog.Logger, validate *validator.Validate, repository OrderEventRepository, broadcaster OrderEventBroadcaster, clock clock.Clock) *PaymentSystemEventHandler {
 	return &PaymentSystemEventHandler{
 		log:         log,
 		validate:    validate,
 		repository:  repository,
 		broadcaster: broadcaster,
+		clock:       clock,
+		pending:     make(map[string]struct{}),
 	}
 }
 
+var tracer = otel.Tracer("order-event-processor/internal/handler")
+
+var (
+	webhooksCounter = metrics.NewCounter("webhooks_total",
+		"Payment system webhooks by response status code and reason.", "code", "reason")
+	webhookDuration = metrics.NewHistogram("webhook_handle_duration_seconds",
+		"Time to handle a payment system webhook.", metrics.DefBuckets, "reason")
+	lockWaitDuration = metrics.NewHistogram("order_lock_wait_seconds",
+		"Time spent waiting for the order lock.", metrics.DefBuckets, "job")
+)
+
+// Reasons of webhook responses, they label webhooksCounter.
+const (
+	reasonApplied           = "applied"
+	reasonBuffered          = "buffered"
+	reasonInvalidJSON       = "invalid_json"
+	reasonInvalidEvent      = "invalid_event"
+	reasonDuplicate         = "duplicate"
+	reasonOrderFinal        = "order_final"
+	reasonInvalidTransition = "invalid_transition"
+	reasonLockFailed        = "lock_failed"
+	reasonStorageError      = "storage_error"
+	reasonCommitFailed      = "commit_failed"
+)
+
+// responseError rolls back the transaction of Handle and is turned into a response with status afterwards.
+type responseError struct {
+	status  int
+	reason  string
+	message string
+	err     error
+}
+
+func (e *responseError) Error() string {
+	return e.message
+}
+
+func (e *responseError) Unwrap() error {
+	return e.err
+}
+
 func (h *PaymentSystemEventHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	startedAt := time.Now()
+	status, reason := h.handle(r)
+	w.WriteHeader(status)
+	webhooksCounter.Inc(strconv.Itoa(status), reason)
+	webhookDuration.Observe(time.Since(startedAt).Seconds(), reason)
+}
+
+// handle processes the webhook and returns the response status and the reason for it.
+func (h *PaymentSystemEventHandler) handle(r *http.Request) (int, string) {
+	log := logger.FromContext(r.Context(), h.log)
 	paymentSystemEvent := model.OrderEvent{}
 	if err := json.NewDecoder(r.Body).Decode(&paymentSystemEvent); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		h.log.Error("failed to decode Payment system broadcaster", "error", err)
-		return
+		log.Error("failed to decode Payment system broadcaster", "error", err)
+		return http.StatusBadRequest, reasonInvalidJSON
 	}
 
+	logger.AddAttrs(r.Context(), "order_id", paymentSystemEvent.OrderID, "event_id", paymentSystemEvent.EventID)
+	log = logger.FromContext(r.Context(), h.log)
+
 	if err := h.validate.Struct(paymentSystemEvent); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		h.log.Error("validation error", "error", err)
-		return
+		log.Error("validation error", "error", err)
+		return http.StatusBadRequest, reasonInvalidEvent
 	}
 
-	h.log.Debug("received payload", "PaymentSystemEvent", paymentSystemEvent)
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(tracing.OrderID(paymentSystemEvent.OrderID), tracing.EventID(paymentSystemEvent.EventID))
 
-	h.repository.RunInTransaction(func() {
-		h.repository.AcquireLock(paymentSystemEvent.OrderID)
+	paymentSystemEvent.ReceivedAt = h.clock.Now().UTC()
+	log.Debug("received payload", "PaymentSystemEvent", paymentSystemEvent)
 
-		exists, err := h.repository.ExistsOrderEventWithEventId(paymentSystemEvent.EventID)
+	var newInOrderEvents []model.OrderEvent
+	var sequence uint64
+	err := h.repository.RunInTransaction(r.Context(), func(ctx context.Context) error {
+		lockedAt := time.Now()
+		if err := h.repository.AcquireLock(ctx, paymentSystemEvent.OrderID); err != nil {
+			return &responseError{http.StatusInternalServerError, reasonLockFailed, "failed to acquire order lock", err}
+		}
+		lockWaitDuration.Observe(time.Since(lockedAt).Seconds(), "webhook")
+
+		exists, err := h.repository.ExistsOrderEventWithEventId(ctx, paymentSystemEvent.EventID)
 		if exists {
-			w.WriteHeader(http.StatusConflict)
-			h.log.Error("order event was already processed", "error", err)
-			return
+			return &responseError{http.StatusConflict, reasonDuplicate, "order event was already processed", err}
 		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.log.Error("failed to check if order is final and in order", "error", err)
-			return
+			return &responseError{http.StatusInternalServerError, reasonStorageError, "failed to check if order is final and in order", err}
 		}
 
-		exists, err = h.repository.ExistsOrderEventForOrderIdFinalAndInOrder(paymentSystemEvent.OrderID)
+		exists, err = h.repository.ExistsOrderEventForOrderIdFinalAndInOrder(ctx, paymentSystemEvent.OrderID)
 		if exists {
-			w.WriteHeader(http.StatusGone)
-			h.log.Error("order is already final and in order", "error", err)
-			return
+			return &responseError{http.StatusGone, reasonOrderFinal, "order is already final and in order", err}
 		} else if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.log.Error("failed to check if order is final and in order", "error", err)
-			return
+			return &responseError{http.StatusInternalServerError, reasonStorageError, "failed to check if order is final and in order", err}
 		}
 
-		events, err := h.repository.GetAllEventsByOrderId(paymentSystemEvent.OrderID)
+		events, err := h.repository.GetAllEventsByOrderId(ctx, paymentSystemEvent.OrderID)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.log.Error("failed to retrieve order events", "error", err)
-			return
+			return &responseError{http.StatusInternalServerError, reasonStorageError, "failed to retrieve order events", err}
 		}
 
-		newInOrderEvents, err := h.getUpdatedInOrderEvents(append(events, paymentSystemEvent))
+		newInOrderEvents, err = ordering.UpdatedInOrderEvents(append(events, paymentSystemEvent))
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			h.log.Error("failed to process broadcaster", "error", err)
-			return
+			return &responseError{http.StatusBadRequest, reasonInvalidTransition, "failed to process broadcaster", err}
+		}
+		appliedAt := h.clock.Now().UTC()
+		for i := range newInOrderEvents {
+			newInOrderEvents[i].AppliedAt = &appliedAt
 		}
 
-		if err := h.repository.InsertOrderEventsOrUpdateIsInOrder(newInOrderEvents...); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.log.Error("error while saving broadcaster", "error", err)
-			return
+		if err := h.repository.InsertOrderEventsOrUpdateIsInOrder(ctx, newInOrderEvents...); err != nil {
+			return &responseError{http.StatusInternalServerError, reasonStorageError, "error while saving broadcaster", err}
 		}
 
 		if !containsId(newInOrderEvents, paymentSystemEvent.EventID) {
-			if err := h.repository.InsertOrderEventsOrUpdateIsInOrder(paymentSystemEvent); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				h.log.Error("error while saving broadcaster", "error", err)
-				return
+			if err := h.repository.InsertOrderEventsOrUpdateIsInOrder(ctx, paymentSystemEvent); err != nil {
+				return &responseError{http.StatusInternalServerError, reasonStorageError, "error while saving broadcaster", err}
 			}
 		}
 		if len(newInOrderEvents) > 0 {
-			if err := h.repository.InsertOrUpdateOrder(newInOrderEvents[len(newInOrderEvents)-1].Order); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				h.log.Error("error while saving order", "error", err)
-				return
-			}
-
-			for _, event := range newInOrderEvents {
-				h.broadcaster.Broadcast(&event)
+			if err := h.repository.InsertOrUpdateOrder(ctx, newInOrderEvents[len(newInOrderEvents)-1].Order); err != nil {
+				return &responseError{http.StatusInternalServerError, reasonStorageError, "error while saving order", err}
 			}
+			// reserved under the order lock, so the events are broadcast in commit order once committed
+			sequence = h.broadcaster.Reserve(paymentSystemEvent.OrderID)
 		}
+		return nil
 	})
+	if sequence > 0 {
+		if err != nil {
+			// lets events of later transactions through
+			newInOrderEvents = nil
+		}
+		_, broadcastSpan := tracer.Start(r.Context(), "broadcast", trace.WithAttributes(
+			tracing.OrderID(paymentSystemEvent.OrderID), attribute.Int("events", len(newInOrderEvents))))
+		h.broadcaster.Publish(paymentSystemEvent.OrderID, sequence, newInOrderEvents...)
+		broadcastSpan.End()
+	}
+	var responseErr *responseError
+	if errors.As(err, &responseErr) {
+		log.Error(responseErr.message, "error", responseErr.err)
+		return responseErr.status, responseErr.reason
+	} else if err != nil {
+		log.Error("failed to commit order event", "error", err)
+		return http.StatusInternalServerError, reasonCommitFailed
+	}
+
+	for _, event := range newInOrderEvents {
+		if event.OrderStatus == model.StatusChinazes {
+			// the delay starts before the response is written, so it is measured from the commit
+			h.ScheduleFinalization(r.Context(), event)
+		}
+	}
+	if !containsId(newInOrderEvents, paymentSystemEvent.EventID) {
+		return http.StatusOK, reasonBuffered
+	}
+	return http.StatusOK, reasonApplied
+}
+
+// ScheduleFinalization starts a job making the chinazes event final after model.ChinazesFinalizationDelay,
+// ctx is only used to link the trace of the job.
+func (h *PaymentSystemEventHandler) ScheduleFinalization(ctx context.Context, event model.OrderEvent) {
+	finalizeAt := h.clock.After(model.ChinazesFinalizationDelay)
+	h.jobs.Add(1)
+	h.setPending(event.OrderID, true)
+	// the job outlives the request, so it starts its own trace linked to the caller
+	link := trace.LinkFromContext(ctx)
+	go func() {
+		defer h.jobs.Done()
+		defer h.setPending(event.OrderID, false)
+		h.finalizeChinazes(event, finalizeAt, link)
+	}()
+}
+
+// WaitForJobs blocks until every started chinazes finalization job has finished.
+func (h *PaymentSystemEventHandler) WaitForJobs() {
+	h.jobs.Wait()
+}
+
+// PendingFinalizations returns ids of orders whose chinazes finalization job has not finished yet.
+func (h *PaymentSystemEventHandler) PendingFinalizations() []string {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	orderIds := make([]string, 0, len(h.pending))
+	for orderId := range h.pending {
+		orderIds = append(orderIds, orderId)
+	}
+	sort.Strings(orderIds)
+	return orderIds
+}
+
+func (h *PaymentSystemEventHandler) setPending(orderId string, pending bool) {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+	if pending {
+		h.pending[orderId] = struct{}{}
+	} else {
+		delete(h.pending, orderId)
+	}
 }
 
 func containsId(orderEvents []model.OrderEvent, id string) bool {
@@ -133,69 +275,62 @@ func containsId(orderEvents []model.OrderEvent, id string) bool {
 	return false
 }
 
-var transitions = map[model.OrderStatus][]model.OrderStatus{
-	model.StatusInitial:                {model.StatusCoolOrderCreated},
-	model.StatusCoolOrderCreated:       {model.StatusSbuVerificationPending, model.StatusChangedMyMind, model.StatusFailed},
-	model.StatusSbuVerificationPending: {model.StatusConfirmedByMayor, model.StatusChangedMyMind, model.StatusFailed},
-	model.StatusConfirmedByMayor:       {model.StatusChinazes, model.StatusChangedMyMind, model.StatusFailed},
-	model.StatusChinazes:               {model.StatusGiveMyMoneyBack},
-}
-
-func (h *PaymentSystemEventHandler) getUpdatedInOrderEvents(orderEvents []model.OrderEvent) ([]model.OrderEvent, error) {
-	sort.Slice(orderEvents, func(i, j int) bool {
-		return orderEvents[i].UpdatedAt.Before(orderEvents[j].UpdatedAt)
+// finalizeChinazes makes the chinazes event final once finalizeAt fires unless give_my_money_back was received
+// in the meantime or the event is no longer the last in order one, an operator may have deleted it
+// or moved the order past it.
+func (h *PaymentSystemEventHandler) finalizeChinazes(event model.OrderEvent, finalizeAt <-chan time.Time, link trace.Link) {
+	log := h.log.With("order_id", event.OrderID, "event_id", event.EventID)
+	log.Debug("started status update job")
+	<-finalizeAt
+	ctx, span := tracer.Start(context.Background(), "finalize chinazes", trace.WithNewRoot(), trace.WithLinks(link),
+		trace.WithAttributes(tracing.OrderID(event.OrderID), tracing.EventID(event.EventID)))
+	defer span.End()
+	var sequence uint64
+	err := h.repository.RunInTransaction(ctx, func(ctx context.Context) error {
+		lockedAt := time.Now()
+		if err := h.repository.AcquireLock(ctx, event.OrderID); err != nil {
+			return err
+		}
+		lockWaitDuration.Observe(time.Since(lockedAt).Seconds(), "finalization")
+		moneyBackStatusExists, err := h.repository.ExistsOrderEventForOrderIdWithStatus(ctx, event.OrderID, model.StatusGiveMyMoneyBack)
+		if moneyBackStatusExists {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error while checking existence of order with status: %w", err)
+		}
+		orderEvents, err := h.repository.GetAllEventsByOrderId(ctx, event.OrderID)
+		if err != nil {
+			return fmt.Errorf("error while getting order events: %w", err)
+		}
+		last, ok := ordering.LastInOrderEvent(orderEvents)
+		if !ok || last.EventID != event.EventID || last.IsFinal {
+			log.Info("skipped finalization, event is no longer the last in order one")
+			return nil
+		}
+		event = last
+		if err := h.repository.UpdateOrderEventFinalStatus(ctx, event.EventID); err != nil {
+			return fmt.Errorf("error while updating event order status: %w", err)
+		}
+		event.IsFinal = true
+		if err := h.repository.InsertOrUpdateOrder(ctx, event.Order); err != nil {
+			return fmt.Errorf("error while saving order: %w", err)
+		}
+		sequence = h.broadcaster.Reserve(event.OrderID)
+		return nil
 	})
-	var changedOrderEvents []model.OrderEvent
-	currentStatus := model.StatusInitial
-	isFinalized := false
-	for _, event := range orderEvents {
-		statuses := transitions[currentStatus]
-		if event.InOrder {
-			currentStatus = event.OrderStatus
-			continue
-		}
-		if isFinalized {
-			return nil, fmt.Errorf("invalid broadcaster %s, after final status", event.EventID)
-		} else if slices.Contains(statuses, event.OrderStatus) {
-			event.InOrder = true
-			event.IsFinal = model.StatusToIsFinal[event.OrderStatus]
-			isFinalized = event.IsFinal
-			changedOrderEvents = append(changedOrderEvents, event)
-			currentStatus = event.OrderStatus
-
-			if event.OrderStatus == model.StatusChinazes {
-				go func() {
-					h.log.Debug("started status update job")
-					time.Sleep(30 * time.Second)
-					h.repository.RunInTransaction(func() {
-						h.repository.AcquireLock(event.OrderID)
-						moneyBackStatusExists, err := h.repository.ExistsOrderEventForOrderIdWithStatus(event.OrderID, model.StatusGiveMyMoneyBack)
-						if moneyBackStatusExists {
-							return
-						} else if err != nil {
-							h.log.Error("error while checking existence of order with status", "error", err)
-							return
-						}
-						err = h.repository.UpdateOrderEventFinalStatus(event.EventID)
-						if err != nil {
-							h.log.Error("error while updating event order status", "error", err)
-							return
-						}
-						event.IsFinal = true
-						if err := h.repository.InsertOrUpdateOrder(event.Order); err != nil {
-							h.log.Error("error while saving order", "error", err)
-							return
-						}
-						h.broadcaster.Broadcast(&event)
-					})
-					h.log.Debug("update job finished")
-				}()
-			}
+	if sequence > 0 {
+		if err != nil {
+			h.broadcaster.Publish(event.OrderID, sequence)
 		} else {
-			break
+			h.broadcaster.Publish(event.OrderID, sequence, event)
 		}
 	}
-	return changedOrderEvents, nil
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("status update job failed", "error", err)
+		return
+	}
+	log.Debug("update job finished")
 }
 
 //func processOrderEvents2(orderEvents []model.EventHolder) {
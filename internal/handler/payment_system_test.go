@@ -1,37 +1,340 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/clock"
+	loggerhandler "order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage/memory"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestPaymentSystemEventHandler_ProcessEvent(t *testing.T) {
-	//logger := slog.New(handler.NewNoOpHandler())
-	//validate := validator.New()
-	//paymentSystemEventHandler := NewPaymentSystemEventHandler(logger, validate)
-	//
-	//eventJson := `
-	//	{
-	//		"event_id": "483ec8f8-4864-427b-a878-ca026fd38f88",
-	//		"order_id": "97a96c29-7631-4cbc-9559-f8866fb03392",
-	//		"user_id": "2c127d70-3b9b-4743-9c2e-74b9f617029f",
-	//		"order_status": "cool_order_created",
-	//		"updated_at":"2019-01-01T00:00:00Z",
-	//		"created_at": "2019-01-01T00:00:00Z"
-	//	}
-	//`
-	//
-	//req, err := http.NewRequest("POST", "", bytes.NewBufferString(eventJson))
-	//if err != nil {
-	//	t.Fatal(err)
-	//}
-	//req.Header.Set("Content-Type", "application/json")
-	//
-	//rr := httptest.NewRecorder()
-	//
-	//paymentSystemEventHandler.Handle(rr, req)
-	//
-	//if status := rr.Code; status != http.StatusOK {
-	//	t.Errorf("handler returned wrong status code: got %v want %v",
-	//		status, http.StatusOK)
-	//}
+func TestPaymentSystemEventHandler_Handle(t *testing.T) {
+	at := func(minutes int) time.Time {
+		return time.Date(2019, 1, 1, 0, minutes, 0, 0, time.UTC)
+	}
+	event := func(eventId string, status model.OrderStatus, minutes int, inOrder bool) model.OrderEvent {
+		return model.OrderEvent{
+			EventID: eventId,
+			Order: model.Order{
+				OrderID:     "order",
+				UserID:      "user",
+				OrderStatus: status,
+				IsFinal:     inOrder && model.StatusToIsFinal[status],
+				UpdatedAt:   at(minutes),
+				CreatedAt:   at(0),
+			},
+			InOrder: inOrder,
+		}
+	}
+	body := func(e model.OrderEvent) string {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	created := event("created", model.StatusCoolOrderCreated, 0, true)
+	pending := event("pending", model.StatusSbuVerificationPending, 10, false)
+	confirmed := event("confirmed", model.StatusConfirmedByMayor, 20, false)
+
+	tests := []struct {
+		name              string
+		body              string
+		repository        *fakeRepository
+		expectedStatus    int
+		expectedInserted  []string
+		expectedOrder     model.OrderStatus
+		expectedBroadcast []string
+	}{
+		{
+			name:           "malformed json",
+			body:           `{"event_id": `,
+			repository:     &fakeRepository{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing required field",
+			body:           `{"event_id": "pending", "order_id": "order", "order_status": "sbu_verification_pending"}`,
+			repository:     &fakeRepository{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "duplicate event",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created, pending}, eventExists: true},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "order already final",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, finalExists: true},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name: "event after final status",
+			body: body(event("changed", model.StatusChangedMyMind, 5, false)),
+			// the buffered event sorts after changed_my_mind, which is final once applied
+			repository:     &fakeRepository{events: []model.OrderEvent{created, pending}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "lock fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"AcquireLock": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "duplicate check fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"ExistsOrderEventWithEventId": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "final check fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"ExistsOrderEventForOrderIdFinalAndInOrder": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "loading events fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"GetAllEventsByOrderId": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "saving events fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"InsertOrderEventsOrUpdateIsInOrder": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "saving order fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"InsertOrUpdateOrder": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "transaction fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, errs: map[string]error{"RunInTransaction": errStorage}},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "commit fails",
+			body:           body(pending),
+			repository:     &fakeRepository{events: []model.OrderEvent{created}, commitErr: errStorage},
+			expectedStatus: http.StatusInternalServerError,
+			// nothing reaches subscribers, the reserved sequence is still published to let later events through
+			expectedBroadcast: nil,
+		},
+		{
+			name:              "in order event",
+			body:              body(pending),
+			repository:        &fakeRepository{events: []model.OrderEvent{created}},
+			expectedStatus:    http.StatusOK,
+			expectedInserted:  []string{"pending"},
+			expectedOrder:     model.StatusSbuVerificationPending,
+			expectedBroadcast: []string{"pending"},
+		},
+		{
+			name:              "event filling a gap",
+			body:              body(pending),
+			repository:        &fakeRepository{events: []model.OrderEvent{created, confirmed}},
+			expectedStatus:    http.StatusOK,
+			expectedInserted:  []string{"pending", "confirmed"},
+			expectedOrder:     model.StatusConfirmedByMayor,
+			expectedBroadcast: []string{"pending", "confirmed"},
+		},
+		{
+			name:             "out of order event",
+			body:             body(confirmed),
+			repository:       &fakeRepository{events: []model.OrderEvent{created}},
+			expectedStatus:   http.StatusOK,
+			expectedInserted: []string{"confirmed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &fakeBroadcaster{}
+			log := slog.New(loggerhandler.NewNoOpHandler())
+			h := NewPaymentSystemEventHandler(log, validator.New(), test.repository, b, clock.NewFake(at(60)))
+
+			rr := httptest.NewRecorder()
+			h.Handle(rr, httptest.NewRequest(http.MethodPost, "/webhooks/payments/orders", strings.NewReader(test.body)))
+
+			if rr.Code != test.expectedStatus {
+				t.Errorf("expected status %d but got %d", test.expectedStatus, rr.Code)
+			}
+			if inserted := eventIdsOf(test.repository.inserted); !slices.Equal(inserted, test.expectedInserted) {
+				t.Errorf("expected inserted events %v but got %v", test.expectedInserted, inserted)
+			}
+			if test.expectedOrder == "" && len(test.repository.orders) > 0 {
+				t.Errorf("expected no order to be saved but got %v", test.repository.orders)
+			} else if test.expectedOrder != "" {
+				if len(test.repository.orders) != 1 || test.repository.orders[0].OrderStatus != test.expectedOrder {
+					t.Errorf("expected order %s to be saved but got %v", test.expectedOrder, test.repository.orders)
+				}
+			}
+			if broadcast := b.eventIds(); !slices.Equal(broadcast, test.expectedBroadcast) {
+				t.Errorf("expected broadcast events %v but got %v", test.expectedBroadcast, broadcast)
+			}
+			if b.published != int(b.reserved) {
+				t.Errorf("expected every reserved sequence to be published but %d of %d were", b.published, b.reserved)
+			}
+		})
+	}
+}
+
+func eventIdsOf(events []model.OrderEvent) []string {
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
+
+func TestPaymentSystemEventHandler_SetsTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repository := &fakeRepository{}
+	log := slog.New(loggerhandler.NewNoOpHandler())
+	h := NewPaymentSystemEventHandler(log, validator.New(), repository, &fakeBroadcaster{}, clock.NewFake(now))
+
+	rr := httptest.NewRecorder()
+	h.Handle(rr, httptest.NewRequest(http.MethodPost, "/webhooks/payments/orders", strings.NewReader(`{
+		"event_id": "created", "order_id": "order", "user_id": "user", "order_status": "cool_order_created",
+		"updated_at": "2019-01-01T00:00:00Z", "created_at": "2019-01-01T00:00:00Z"
+	}`)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, rr.Code)
+	}
+	if len(repository.inserted) != 1 {
+		t.Fatalf("expected one inserted event but got %d", len(repository.inserted))
+	}
+	inserted := repository.inserted[0]
+	if !inserted.ReceivedAt.Equal(now) || inserted.AppliedAt == nil || !inserted.AppliedAt.Equal(now) {
+		t.Errorf("expected received_at and applied_at %v but got %v and %v", now, inserted.ReceivedAt, inserted.AppliedAt)
+	}
+	if !inserted.InOrder {
+		t.Error("expected event to be in order")
+	}
+}
+
+type finalizationFixture struct {
+	handler *PaymentSystemEventHandler
+	storage *memory.Storage
+	clock   *clock.Fake
+}
+
+func newFinalizationFixture() *finalizationFixture {
+	storage := memory.New()
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	producer := broadcaster.NewFromDbEventProducer(storage)
+	orderEventBroadcaster := broadcaster.NewOrderEventBroadcaster(producer)
+	producer.OrderEventBroadcaster = orderEventBroadcaster
+	log := slog.New(loggerhandler.NewNoOpHandler())
+	return &finalizationFixture{
+		handler: NewPaymentSystemEventHandler(log, validator.New(), storage, orderEventBroadcaster, fakeClock),
+		storage: storage,
+		clock:   fakeClock,
+	}
+}
+
+func (f *finalizationFixture) post(t *testing.T, eventId string, status model.OrderStatus) int {
+	t.Helper()
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	body, err := json.Marshal(model.OrderEvent{
+		EventID: eventId,
+		Order: model.Order{
+			OrderID:     "97a96c29-7631-4cbc-9559-f8866fb03300",
+			UserID:      "2c127d70-3b9b-4743-9c2e-74b9f617029f",
+			OrderStatus: status,
+			UpdatedAt:   createdAt,
+			CreatedAt:   createdAt,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	f.handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/webhooks/payments/orders", bytes.NewReader(body)))
+	return rr.Code
+}
+
+func (f *finalizationFixture) postUntilChinazes(t *testing.T) {
+	t.Helper()
+	statuses := []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor, model.StatusChinazes}
+	for i, status := range statuses {
+		if code := f.post(t, fmt.Sprintf("event-%d", i), status); code != http.StatusOK {
+			t.Fatalf("expected status %d for %s but got %d", http.StatusOK, status, code)
+		}
+	}
+}
+
+func (f *finalizationFixture) order(t *testing.T) model.Order {
+	t.Helper()
+	order, err := f.storage.GetOrder(context.Background(), "97a96c29-7631-4cbc-9559-f8866fb03300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestPaymentSystemEventHandler_ChinazesBecomesFinalAfterDelay(t *testing.T) {
+	f := newFinalizationFixture()
+	f.postUntilChinazes(t)
+
+	f.clock.Advance(model.ChinazesFinalizationDelay - time.Second)
+	if order := f.order(t); order.IsFinal {
+		t.Error("expected order not to be final before the finalization delay")
+	}
+
+	f.clock.Advance(time.Second)
+	f.handler.WaitForJobs()
+	order := f.order(t)
+	if order.OrderStatus != model.StatusChinazes || !order.IsFinal {
+		t.Errorf("expected final chinazes order but got %s, final %t", order.OrderStatus, order.IsFinal)
+	}
+	if code := f.post(t, "event-refund", model.StatusGiveMyMoneyBack); code != http.StatusGone {
+		t.Errorf("expected refund after finalization to be rejected with %d but got %d", http.StatusGone, code)
+	}
+}
+
+func TestPaymentSystemEventHandler_RefundBeforeDelayPreventsFinalization(t *testing.T) {
+	f := newFinalizationFixture()
+	f.postUntilChinazes(t)
+
+	f.clock.Advance(model.ChinazesFinalizationDelay - time.Second)
+	if code := f.post(t, "event-refund", model.StatusGiveMyMoneyBack); code != http.StatusOK {
+		t.Fatalf("expected refund to be accepted but got %d", code)
+	}
+
+	f.clock.Advance(time.Second)
+	f.handler.WaitForJobs()
+	order := f.order(t)
+	if order.OrderStatus != model.StatusGiveMyMoneyBack || !order.IsFinal {
+		t.Errorf("expected final give_my_money_back order but got %s, final %t", order.OrderStatus, order.IsFinal)
+	}
+	events, err := f.storage.GetAllEventsByOrderId(context.Background(), "97a96c29-7631-4cbc-9559-f8866fb03300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		if event.OrderStatus == model.StatusChinazes && event.IsFinal {
+			t.Error("expected chinazes event not to be finalized after refund")
+		}
+	}
 }
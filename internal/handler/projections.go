@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+	"strconv"
+)
+
+type ProjectionRebuilder interface {
+	Rebuild(ctx context.Context, dryRun bool) (model.RebuildReport, error)
+}
+
+type ProjectionsHandler struct {
+	log       *slog.Logger
+	rebuilder ProjectionRebuilder
+}
+
+func NewProjectionsHandler(log *slog.Logger, rebuilder ProjectionRebuilder) *ProjectionsHandler {
+	return &ProjectionsHandler{
+		log:       log,
+		rebuilder: rebuilder,
+	}
+}
+
+func (h *ProjectionsHandler) Rebuild(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	dryRun := false
+	if rawDryRun := r.URL.Query().Get("dry_run"); rawDryRun != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(rawDryRun)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error("invalid dry_run parameter", "error", err)
+			return
+		}
+	}
+
+	report, err := h.rebuilder.Rebuild(r.Context(), dryRun)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while rebuilding projections", "error", err)
+		return
+	}
+	log.Info("rebuilt projections", "dry_run", dryRun, "orders_scanned", report.OrdersScanned, "orders_changed", report.OrdersChanged)
+
+	if err = httputil.WriteJSON(w, report); err != nil {
+		log.Error("error while writing rebuild report", "error", err)
+		return
+	}
+}
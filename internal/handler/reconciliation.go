@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+)
+
+type OrdersReconciler interface {
+	Check(ctx context.Context) (model.ReconciliationReport, error)
+	Reconcile(ctx context.Context) (model.ReconciliationReport, error)
+}
+
+type ReconciliationHandler struct {
+	log        *slog.Logger
+	reconciler OrdersReconciler
+}
+
+func NewReconciliationHandler(log *slog.Logger, reconciler OrdersReconciler) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		log:        log,
+		reconciler: reconciler,
+	}
+}
+
+// GetMismatches reports orders rows which disagree with the last in order event without repairing them.
+func (h *ReconciliationHandler) GetMismatches(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	report, err := h.reconciler.Check(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while checking orders consistency", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, report); err != nil {
+		log.Error("error while writing reconciliation report", "error", err)
+		return
+	}
+}
+
+// Reconcile runs a reconciliation immediately, mismatches are repaired only if auto repair is enabled.
+func (h *ReconciliationHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	report, err := h.reconciler.Reconcile(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while reconciling orders", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, report); err != nil {
+		log.Error("error while writing reconciliation report", "error", err)
+		return
+	}
+}
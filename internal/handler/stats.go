@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"order-event-processor/internal/lib/logger"
+	"order-event-processor/internal/model"
+	"time"
+)
+
+const defaultStatsWindow = time.Hour
+
+type EventStatsProvider interface {
+	GetEventStats(ctx context.Context, window time.Duration) (model.EventStats, error)
+}
+
+type StatsHandler struct {
+	log      *slog.Logger
+	provider EventStatsProvider
+}
+
+func NewStatsHandler(log *slog.Logger, provider EventStatsProvider) *StatsHandler {
+	return &StatsHandler{
+		log:      log,
+		provider: provider,
+	}
+}
+
+func (h *StatsHandler) GetEventStats(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context(), h.log)
+	window := defaultStatsWindow
+	if rawWindow := r.URL.Query().Get("window"); rawWindow != "" {
+		var err error
+		window, err = time.ParseDuration(rawWindow)
+		if err != nil || window <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Error("invalid window parameter", "window", rawWindow, "error", err)
+			return
+		}
+	}
+
+	stats, err := h.provider.GetEventStats(r.Context(), window)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("error while getting event stats", "error", err)
+		return
+	}
+
+	if err = httputil.WriteJSON(w, stats); err != nil {
+		log.Error("error while writing event stats", "error", err)
+		return
+	}
+}
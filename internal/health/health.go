@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"order-event-processor/internal/model"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by storages, Ping fails when the database is not reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	run  CheckFunc
+}
+
+// Checker runs named readiness checks in parallel, each bounded by timeout.
+type Checker struct {
+	mutex   sync.Mutex
+	checks  []check
+	timeout time.Duration
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+	}
+}
+
+// Add registers a check, checks may be added after the server started.
+func (c *Checker) Add(name string, run CheckFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks = append(c.checks, check{name: name, run: run})
+}
+
+// CheckReadiness is ready only if every check passed, results keep the order checks were added in.
+func (c *Checker) CheckReadiness(ctx context.Context) model.Readiness {
+	c.mutex.Lock()
+	checks := append([]check(nil), c.checks...)
+	c.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]model.HealthCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			startedAt := time.Now()
+			err := check.run(ctx)
+			results[i] = model.HealthCheck{Name: check.name, DurationMs: time.Since(startedAt).Milliseconds()}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	readiness := model.Readiness{Ready: true, Checks: results}
+	for _, result := range results {
+		if result.Error != "" {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker_CheckReadiness(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("passing", func(ctx context.Context) error {
+		return nil
+	})
+	checker.Add("failing", func(ctx context.Context) error {
+		return errors.New("unreachable")
+	})
+	checker.Add("hanging", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	readiness := checker.CheckReadiness(context.Background())
+	if readiness.Ready {
+		t.Error("expected not ready")
+	}
+	expectedErrors := []string{"", "unreachable", context.DeadlineExceeded.Error()}
+	if len(readiness.Checks) != len(expectedErrors) {
+		t.Fatalf("expected %d checks but got %d", len(expectedErrors), len(readiness.Checks))
+	}
+	for i, expected := range expectedErrors {
+		if readiness.Checks[i].Error != expected {
+			t.Errorf("expected check %s to fail with %q but got %q", readiness.Checks[i].Name, expected, readiness.Checks[i].Error)
+		}
+	}
+}
+
+func TestChecker_ReadyWithoutChecks(t *testing.T) {
+	if !NewChecker(time.Second).CheckReadiness(context.Background()).Ready {
+		t.Error("expected ready")
+	}
+}
@@ -7,6 +7,11 @@ import (
 )
 
 func WriteJSON(w http.ResponseWriter, v interface{}) error {
+	return WriteJSONWithStatus(w, http.StatusOK, v)
+}
+
+// WriteJSONWithStatus writes v with status, encoding errors are answered with 500 instead.
+func WriteJSONWithStatus(w http.ResponseWriter, status int, v interface{}) error {
 	buf := &bytes.Buffer{}
 	enc := json.NewEncoder(buf)
 
@@ -16,11 +21,54 @@ func WriteJSON(w http.ResponseWriter, v interface{}) error {
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
 
 	if _, err := w.Write(buf.Bytes()); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		return err
 	}
 
 	return nil
 }
+
+// StatusRecorder remembers the status and counts the bytes written through it,
+// it keeps http.Flusher working for event streams.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{
+		ResponseWriter: w,
+		Status:         http.StatusOK,
+	}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+func (r *StatusRecorder) Flush() {
+	r.wroteHeader = true
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
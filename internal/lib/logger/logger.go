@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New creates a logger writing to w in format, level may be a *slog.LevelVar to change it at runtime.
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// ParseLevel accepts the level names of slog, such as debug or WARN, optionally with an offset like info+2.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, err
+	}
+	return level, nil
+}
+
+type scopeKey struct{}
+
+// scope holds the logger of a request, attributes added while handling the request reach every later log line,
+// including the access log written by Middleware.
+type scope struct {
+	mutex sync.Mutex
+	log   *slog.Logger
+}
+
+// NewContext starts a request scope logging with log.
+func NewContext(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{log: log})
+}
+
+// FromContext returns the logger of the request scope in ctx, or fallback outside of requests.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return fallback
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.log
+}
+
+// AddAttrs adds attributes, given like the args of slog.Logger.With, to the request scope in ctx.
+// Without a scope it does nothing.
+func AddAttrs(ctx context.Context, args ...any) {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.log = s.log.With(args...)
+}
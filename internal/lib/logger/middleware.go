@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+	"order-event-processor/internal/lib/httputil"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength keeps ids sent by clients from bloating every log line.
+const maxRequestIDLength = 128
+
+// Middleware logs every request once it is served and gives handlers a request-scoped logger carrying request_id.
+// The id is taken from the X-Request-ID header when it looks sane and generated otherwise, it is echoed in the
+// response. Requests to quietPaths, such as probes, are logged at debug level.
+func Middleware(log *slog.Logger, next http.Handler, quietPaths ...string) http.Handler {
+	quiet := make(map[string]bool, len(quietPaths))
+	for _, path := range quietPaths {
+		quiet[path] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startedAt := time.Now()
+		requestId := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestId)
+
+		ctx := NewContext(r.Context(), log.With("request_id", requestId))
+		recorder := httputil.NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if quiet[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		FromContext(ctx, log).Log(ctx, level, "request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.Status,
+			"duration_ms", time.Since(startedAt).Milliseconds(),
+			"bytes", recorder.Bytes,
+		)
+	})
+}
+
+func validRequestID(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestId {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
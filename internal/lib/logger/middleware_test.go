@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name              string
+		requestId         string
+		expectedRequestId string
+	}{
+		{
+			name:              "propagates request id",
+			requestId:         "provider-42",
+			expectedRequestId: "provider-42",
+		},
+		{
+			name: "generates missing request id",
+		},
+		{
+			name:      "replaces invalid request id",
+			requestId: "bad id\n",
+		},
+		{
+			name:      "replaces too long request id",
+			requestId: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			log := slog.New(slog.NewJSONHandler(&output, nil))
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				AddAttrs(r.Context(), "order_id", "order")
+				FromContext(r.Context(), nil).Info("handled")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("done"))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+			if test.requestId != "" {
+				req.Header.Set(RequestIDHeader, test.requestId)
+			}
+			rr := httptest.NewRecorder()
+			Middleware(log, next).ServeHTTP(rr, req)
+
+			requestId := rr.Header().Get(RequestIDHeader)
+			if test.expectedRequestId != "" && requestId != test.expectedRequestId {
+				t.Errorf("expected request id %q but got %q", test.expectedRequestId, requestId)
+			}
+			if test.expectedRequestId == "" && (requestId == "" || requestId == test.requestId) {
+				t.Errorf("expected a generated request id but got %q", requestId)
+			}
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("expected handler and access log lines but got %q", output.String())
+			}
+			var handled, served map[string]any
+			if err := json.Unmarshal([]byte(lines[0]), &handled); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(lines[1]), &served); err != nil {
+				t.Fatal(err)
+			}
+			if handled["request_id"] != requestId || handled["order_id"] != "order" {
+				t.Errorf("expected handler log with request and order id but got %v", handled)
+			}
+			expected := map[string]any{
+				"msg":        "request served",
+				"request_id": requestId,
+				"order_id":   "order",
+				"method":     http.MethodPost,
+				"path":       "/orders",
+				"status":     float64(http.StatusCreated),
+				"bytes":      float64(len("done")),
+			}
+			for key, value := range expected {
+				if served[key] != value {
+					t.Errorf("expected access log %s %v but got %v", key, value, served[key])
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareLogsQuietPathsAtDebug(t *testing.T) {
+	var output bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	Middleware(log, next, "/healthz").ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if output.Len() != 0 {
+		t.Errorf("expected no access log at info level but got %q", output.String())
+	}
+}
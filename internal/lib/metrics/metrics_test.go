@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("webhooks_total", "Webhooks by outcome.", "code", "reason")
+	counter.Inc("200", "applied")
+	counter.Inc("200", "applied")
+	counter.Add(3, "400", `bad "json"`)
+	gauge := registry.NewGauge("subscribers", "Active subscribers.")
+	gauge.Add(2)
+	gauge.Add(-1)
+	registry.NewGaugeFunc("pool_conns", "Open connections.", func() float64 { return 4 })
+	histogram := registry.NewHistogram("latency_seconds", "Latency\nin seconds.", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var builder strings.Builder
+	w := bufio.NewWriter(&builder)
+	registry.Write(w)
+	w.Flush()
+
+	expected := `# HELP latency_seconds Latency\nin seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP pool_conns Open connections.
+# TYPE pool_conns gauge
+pool_conns 4
+# HELP subscribers Active subscribers.
+# TYPE subscribers gauge
+subscribers 1
+# HELP webhooks_total Webhooks by outcome.
+# TYPE webhooks_total counter
+webhooks_total{code="200",reason="applied"} 2
+webhooks_total{code="400",reason="bad \"json\""} 3
+`
+	if builder.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, builder.String())
+	}
+}
+
+func TestRegistry_DuplicateNamePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("events_total", "Events.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate registration to panic")
+		}
+	}()
+	registry.NewGauge("events_total", "Events.")
+}
@@ -0,0 +1,184 @@
+// Package migration applies the embedded migrations to a database and reports their state.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	sqlitemigrate "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"log/slog"
+	"order-event-processor/internal/config"
+	"order-event-processor/migrations"
+	"os"
+	"strings"
+)
+
+// ErrNoMigrations is returned for drivers without a schema, such as the in-memory storage.
+var ErrNoMigrations = errors.New("driver has no migrations")
+
+// Migrator runs the migrations of one driver against db, the versions are the numeric prefixes of the files.
+type Migrator struct {
+	m        *migrate.Migrate
+	versions []uint
+}
+
+// New does not take ownership of db, it stays open for the storage using it.
+func New(log *slog.Logger, driver string, db *sql.DB) (*Migrator, error) {
+	var dir string
+	var instance database.Driver
+	var err error
+	switch driver {
+	case config.DriverPostgres:
+		dir = "."
+		instance, err = postgres.WithInstance(db, &postgres.Config{})
+	case config.DriverSqlite:
+		dir = "sqlite"
+		instance, err = sqlitemigrate.WithInstance(db, &sqlitemigrate.Config{})
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoMigrations, driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire database driver: %w", err)
+	}
+
+	src, err := iofs.New(migrations.FS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open migrations: %w", err)
+	}
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, driver, instance)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up migrations: %w", err)
+	}
+	m.Log = logAdapter{log: log}
+	return &Migrator{m: m, versions: versions}, nil
+}
+
+func sourceVersions(src source.Driver) ([]uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read first migration: %w", err)
+	}
+	versions := []uint{version}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return versions, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read migration after %d: %w", version, err)
+		}
+		versions = append(versions, next)
+		version = next
+	}
+}
+
+// Up applies every pending migration, it does nothing when the database is up to date.
+func (m *Migrator) Up() error {
+	return ignoreNoChange(m.m.Up())
+}
+
+// Down rolls back the last steps migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	return ignoreNoChange(m.m.Steps(-steps))
+}
+
+// Goto migrates up or down to version.
+func (m *Migrator) Goto(version uint) error {
+	if !m.known(version) {
+		return fmt.Errorf("unknown migration version %d, latest is %d", version, m.Latest())
+	}
+	return ignoreNoChange(m.m.Migrate(version))
+}
+
+// Force records version without running migrations and clears the dirty flag, it is meant for repairing
+// a failed migration by hand. -1 records that no migration is applied.
+func (m *Migrator) Force(version int) error {
+	if version != -1 && (version < 0 || !m.known(uint(version))) {
+		return fmt.Errorf("unknown migration version %d, latest is %d", version, m.Latest())
+	}
+	return m.m.Force(version)
+}
+
+func (m *Migrator) known(version uint) bool {
+	for _, v := range m.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) Latest() uint {
+	return m.versions[len(m.versions)-1]
+}
+
+// Status is the state of the database, Version is 0 before the first migration.
+type Status struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []uint
+}
+
+func (m *Migrator) Status() (Status, error) {
+	version, dirty, err := m.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return Status{}, fmt.Errorf("unable to read migration version: %w", err)
+	}
+	status := Status{Version: version, Dirty: dirty, Latest: m.Latest()}
+	for _, v := range m.versions {
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	return status, nil
+}
+
+// Check fails unless the database is clean and at the latest migration, a server started against a database
+// migrated by an older or newer release is not ready.
+func (m *Migrator) Check(_ context.Context) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return fmt.Errorf("migration %d is dirty", status.Version)
+	}
+	if status.Version != status.Latest {
+		return fmt.Errorf("database is at migration %d, expected %d", status.Version, status.Latest)
+	}
+	return nil
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// logAdapter reports every applied migration, migrate prints them through its Logger.
+type logAdapter struct {
+	log *slog.Logger
+}
+
+func (l logAdapter) Printf(format string, v ...any) {
+	l.log.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l logAdapter) Verbose() bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"context"
+	"log/slog"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/storage/sqlite"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newMigrator(t *testing.T) *Migrator {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := New(slog.New(handler.NewNoOpHandler()), config.DriverSqlite, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrator
+}
+
+func expectStatus(t *testing.T, migrator *Migrator, version uint, pending ...uint) {
+	t.Helper()
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != version || status.Dirty || !slices.Equal(status.Pending, pending) {
+		t.Fatalf("status = %+v, expected version %d with pending %v", status, version, pending)
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	migrator := newMigrator(t)
+	latest := migrator.Latest()
+	if latest < 2 {
+		t.Fatalf("expected at least two migrations but the latest is %d", latest)
+	}
+	expectStatus(t, migrator, 0, migrator.versions...)
+	if err := migrator.Check(context.Background()); err == nil {
+		t.Error("expected check of an empty database to fail")
+	}
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, migrator, latest)
+	if err := migrator.Check(context.Background()); err != nil {
+		t.Errorf("expected check to pass: %v", err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Errorf("expected up to date database to be left alone: %v", err)
+	}
+
+	if err := migrator.Down(1); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, migrator, latest-1, latest)
+
+	if err := migrator.Goto(1); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, migrator, 1, migrator.versions[1:]...)
+
+	if err := migrator.Force(int(latest)); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, migrator, latest)
+}
+
+func TestMigrator_RejectsUnknownVersions(t *testing.T) {
+	migrator := newMigrator(t)
+	unknown := migrator.Latest() + 1
+	if err := migrator.Goto(unknown); err == nil {
+		t.Error("expected goto to an unknown version to fail")
+	}
+	if err := migrator.Force(int(unknown)); err == nil {
+		t.Error("expected force of an unknown version to fail")
+	}
+	if err := migrator.Down(0); err == nil {
+		t.Error("expected down without steps to fail")
+	}
+}
+
+func TestNew_RejectsDriversWithoutMigrations(t *testing.T) {
+	if _, err := New(slog.New(handler.NewNoOpHandler()), config.DriverMemory, nil); err == nil {
+		t.Error("expected memory driver to have no migrations")
+	}
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Actions of audit entries, one per kind of manual change to an order.
+const (
+	AuditActionReorder     = "reorder"
+	AuditActionFinalize    = "finalize"
+	AuditActionTransition  = "transition"
+	AuditActionForceStatus = "force_status"
+	AuditActionDeleteEvent = "delete_event"
+)
+
+// AuditEntry records a manual change to an order, EventID names the event created, changed or deleted by it.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	OrderID    string    `json:"order_id"`
+	EventID    string    `json:"event_id,omitempty"`
+	Action     string    `json:"action"`
+	OperatorID string    `json:"operator_id"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OperatorAction names who changes an order and why, it is required by every manual change.
+type OperatorAction struct {
+	OperatorID string `json:"operator_id" validate:"required"`
+	Reason     string `json:"reason" validate:"required"`
+}
+
+// TransitionRequest moves an order to Status, Force skips the check against Transitions.
+type TransitionRequest struct {
+	OperatorAction
+	Status OrderStatus `json:"status" validate:"required"`
+	Force  bool        `json:"force"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type BufferedEvent struct {
+	EventID     string      `json:"event_id"`
+	OrderStatus OrderStatus `json:"order_status"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	ReceivedAt  time.Time   `json:"received_at"`
+}
+
+type BufferedOrder struct {
+	OrderID         string          `json:"order_id"`
+	CurrentStatus   OrderStatus     `json:"current_status"`
+	MissingStatuses []OrderStatus   `json:"missing_statuses"`
+	BufferedEvents  []BufferedEvent `json:"buffered_events"`
+	WaitingSince    time.Time       `json:"waiting_since"`
+	WaitingSeconds  float64         `json:"waiting_seconds"`
+}
@@ -25,6 +25,17 @@ var StatusToIsFinal = map[OrderStatus]bool{
 	StatusGiveMyMoneyBack:        true,
 }
 
+// ChinazesFinalizationDelay is how long a chinazes order waits for give_my_money_back before it becomes final.
+const ChinazesFinalizationDelay = 30 * time.Second
+
+var Transitions = map[OrderStatus][]OrderStatus{
+	StatusInitial:                {StatusCoolOrderCreated},
+	StatusCoolOrderCreated:       {StatusSbuVerificationPending, StatusChangedMyMind, StatusFailed},
+	StatusSbuVerificationPending: {StatusConfirmedByMayor, StatusChangedMyMind, StatusFailed},
+	StatusConfirmedByMayor:       {StatusChinazes, StatusChangedMyMind, StatusFailed},
+	StatusChinazes:               {StatusGiveMyMoneyBack},
+}
+
 type Order struct {
 	OrderID     string      `json:"order_id" validate:"required"`
 	UserID      string      `json:"user_id" validate:"required"`
@@ -37,5 +48,11 @@ type Order struct {
 type OrderEvent struct {
 	EventID string `json:"event_id" validate:"required"`
 	Order
-	InOrder bool
+	InOrder    bool
+	ReceivedAt time.Time  `json:"-"`
+	AppliedAt  *time.Time `json:"-"`
+	// OperatorID is set on events an operator created instead of the payment system, such an event follows
+	// any status updated before it, see ordering.Chain. Webhooks cannot set it.
+	OperatorID     string `json:"-"`
+	OperatorReason string `json:"-"`
 }
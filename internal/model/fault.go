@@ -0,0 +1,14 @@
+package model
+
+// StorageFault is injected into calls of Method of the storage. The first After calls pass, the following Times calls
+// or, when Times is 0, all following calls wait LatencyMs and then fail with Error or a lock timeout if either is set.
+type StorageFault struct {
+	Method      string `json:"method" validate:"required"`
+	LatencyMs   int64  `json:"latency_ms,omitempty" validate:"gte=0"`
+	Error       string `json:"error,omitempty"`
+	LockTimeout bool   `json:"lock_timeout,omitempty"`
+	After       int    `json:"after,omitempty" validate:"gte=0"`
+	Times       int    `json:"times,omitempty" validate:"gte=0"`
+	// Calls counts calls of Method since the fault was set, it is ignored in requests.
+	Calls int `json:"calls"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Timeline selects which event timestamp is compared with the point in time of a query.
+type Timeline string
+
+const (
+	TimelineUpdatedAt  Timeline = "updated_at"
+	TimelineReceivedAt Timeline = "received_at"
+)
+
+type OrderState struct {
+	Order
+	IsFinal  bool      `json:"is_final"`
+	AsOf     time.Time `json:"as_of"`
+	Timeline Timeline  `json:"timeline"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OrderRow is an orders table row, unlike Order it exposes is_final.
+type OrderRow struct {
+	Order
+	IsFinal bool `json:"is_final"`
+}
+
+type EventDiff struct {
+	EventID       string `json:"event_id"`
+	InOrderBefore bool   `json:"is_in_order_before"`
+	InOrderAfter  bool   `json:"is_in_order_after"`
+	IsFinalBefore bool   `json:"is_final_before"`
+	IsFinalAfter  bool   `json:"is_final_after"`
+}
+
+type OrderDiff struct {
+	OrderID        string      `json:"order_id"`
+	Events         []EventDiff `json:"events"`
+	OrderBefore    *OrderRow   `json:"order_before"`
+	OrderAfter     *OrderRow   `json:"order_after"`
+	RejectedEvents []string    `json:"rejected_events"`
+}
+
+func (d OrderDiff) String() string {
+	var b strings.Builder
+	for _, event := range d.Events {
+		fmt.Fprintf(&b, "order %s: event %s is_in_order %t -> %t, is_final %t -> %t\n",
+			d.OrderID, event.EventID, event.InOrderBefore, event.InOrderAfter, event.IsFinalBefore, event.IsFinalAfter)
+	}
+	if d.OrderBefore != nil || d.OrderAfter != nil {
+		fmt.Fprintf(&b, "order %s: row %s -> %s\n", d.OrderID, d.OrderBefore, d.OrderAfter)
+	}
+	for _, eventId := range d.RejectedEvents {
+		fmt.Fprintf(&b, "order %s: event %s would be rejected\n", d.OrderID, eventId)
+	}
+	return b.String()
+}
+
+func (r *OrderRow) String() string {
+	if r == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("{status: %s, is_final: %t, updated_at: %s, created_at: %s}", r.OrderStatus, r.IsFinal, r.UpdatedAt, r.CreatedAt)
+}
+
+type RebuildReport struct {
+	DryRun        bool        `json:"dry_run"`
+	OrdersScanned int         `json:"orders_scanned"`
+	OrdersChanged int         `json:"orders_changed"`
+	Failed        []string    `json:"failed"`
+	Diffs         []OrderDiff `json:"diffs"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type OrderMismatch struct {
+	OrderID string `json:"order_id"`
+	// Stored is the orders row, nil if it is missing.
+	Stored *OrderRow `json:"stored"`
+	// Expected is derived from the last in order event, nil if the order has no in order events.
+	Expected *OrderRow `json:"expected"`
+	Fields   []string  `json:"fields"`
+	Repaired bool      `json:"repaired"`
+}
+
+type ReconciliationReport struct {
+	CheckedAt     time.Time       `json:"checked_at"`
+	OrdersChecked int             `json:"orders_checked"`
+	Mismatches    []OrderMismatch `json:"mismatches"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type EventTiming struct {
+	UpdatedAt  time.Time
+	ReceivedAt time.Time
+	AppliedAt  *time.Time
+}
+
+// LatencySummary holds percentiles of a latency distribution in seconds.
+type LatencySummary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+type EventStats struct {
+	Since time.Time `json:"since"`
+	// ProviderDeliveryLag is the time between updated_at set by the provider and receiving the event.
+	ProviderDeliveryLag LatencySummary `json:"provider_delivery_lag"`
+	// BufferingDelay is the time between receiving an event and it becoming in order.
+	BufferingDelay LatencySummary `json:"buffering_delay"`
+	// NotAppliedEvents are received events which are still waiting for a predecessor.
+	NotAppliedEvents int `json:"not_applied_events"`
+}
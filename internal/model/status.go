@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// HealthCheck is the outcome of a readiness check, Error is empty if the check passed.
+type HealthCheck struct {
+	Name       string `json:"name"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Readiness struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// PoolStats describes the database connection pool, storages without a pool do not report it.
+type PoolStats struct {
+	MaxConns      int32 `json:"max_conns"`
+	TotalConns    int32 `json:"total_conns"`
+	AcquiredConns int32 `json:"acquired_conns"`
+	IdleConns     int32 `json:"idle_conns"`
+	// WaitCount counts acquires which had to wait for a connection, WaitDurationMs is their total wait.
+	WaitCount      int64 `json:"wait_count"`
+	WaitDurationMs int64 `json:"wait_duration_ms"`
+}
+
+type StreamStats struct {
+	Orders      int `json:"orders"`
+	Subscribers int `json:"subscribers"`
+}
+
+// SchedulerStats is the backlog of background work.
+type SchedulerStats struct {
+	// PendingFinalizations are orders whose chinazes status waits to become final.
+	PendingFinalizations []string `json:"pending_finalizations"`
+	BufferedOrders       int      `json:"buffered_orders"`
+	BufferedEvents       int      `json:"buffered_events"`
+}
+
+type ServerStatus struct {
+	Env           string         `json:"env"`
+	StartedAt     time.Time      `json:"started_at"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Readiness     Readiness      `json:"readiness"`
+	Pool          *PoolStats     `json:"pool,omitempty"`
+	Streams       StreamStats    `json:"streams"`
+	Scheduler     SchedulerStats `json:"scheduler"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// TimelineEvent is an event as stored, including the fields hidden from webhook payloads.
+type TimelineEvent struct {
+	EventID     string      `json:"event_id"`
+	OrderStatus OrderStatus `json:"order_status"`
+	InOrder     bool        `json:"in_order"`
+	IsFinal     bool        `json:"is_final"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	ReceivedAt  time.Time   `json:"received_at"`
+	AppliedAt   *time.Time  `json:"applied_at,omitempty"`
+	OperatorID  string      `json:"operator_id,omitempty"`
+	Reason      string      `json:"reason,omitempty"`
+}
+
+// OrderTimeline lists the in order events of an order in the order they were applied and the buffered events
+// waiting for a predecessor by updated_at. Status and IsFinal are those of the orders row.
+type OrderTimeline struct {
+	OrderID  string          `json:"order_id"`
+	Status   OrderStatus     `json:"status"`
+	IsFinal  bool            `json:"is_final"`
+	InOrder  []TimelineEvent `json:"in_order"`
+	Buffered []TimelineEvent `json:"buffered"`
+}
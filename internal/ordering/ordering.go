@@ -0,0 +1,146 @@
+package ordering
+
+import (
+	"fmt"
+	"order-event-processor/internal/model"
+	"slices"
+	"sort"
+	"time"
+)
+
+// UpdatedInOrderEvents sorts events by updated_at and returns events which become in order, with is_in_order and
+// is_final set. It fails if an event that is not in order follows a final one. Like in Chain, events created by
+// an operator follow any status but never start an order.
+func UpdatedInOrderEvents(orderEvents []model.OrderEvent) ([]model.OrderEvent, error) {
+	sort.Slice(orderEvents, func(i, j int) bool {
+		return orderEvents[i].UpdatedAt.Before(orderEvents[j].UpdatedAt)
+	})
+	var changedOrderEvents []model.OrderEvent
+	currentStatus := model.StatusInitial
+	isFinalized := false
+	for _, event := range orderEvents {
+		statuses := model.Transitions[currentStatus]
+		if event.InOrder {
+			currentStatus = event.OrderStatus
+			continue
+		}
+		if isFinalized {
+			return nil, fmt.Errorf("invalid broadcaster %s, after final status", event.EventID)
+		} else if slices.Contains(statuses, event.OrderStatus) || (event.OperatorID != "" && currentStatus != model.StatusInitial) {
+			event.InOrder = true
+			event.IsFinal = model.StatusToIsFinal[event.OrderStatus]
+			isFinalized = event.IsFinal
+			changedOrderEvents = append(changedOrderEvents, event)
+			currentStatus = event.OrderStatus
+		} else {
+			break
+		}
+	}
+	return changedOrderEvents, nil
+}
+
+// Chain follows model.Transitions from model.StatusInitial through the given events and returns the events
+// forming the in order prefix of the order. When several events are allowed next, the earliest by updated_at wins.
+// Events created by an operator are allowed next regardless of their status once they were updated after the
+// last event of the chain.
+func Chain(orderEvents []model.OrderEvent) []model.OrderEvent {
+	var chain []model.OrderEvent
+	currentStatus := model.StatusInitial
+	for {
+		next, ok := earliestNext(orderEvents, model.Transitions[currentStatus], chain)
+		if !ok {
+			return chain
+		}
+		chain = append(chain, next)
+		currentStatus = next.OrderStatus
+	}
+}
+
+// CurrentStatus returns the status of the last in order event or model.StatusInitial if there is none.
+func CurrentStatus(orderEvents []model.OrderEvent) model.OrderStatus {
+	last, ok := LastInOrderEvent(orderEvents)
+	if !ok {
+		return model.StatusInitial
+	}
+	return last.OrderStatus
+}
+
+// InOrderChain returns events marked in order in the order they were applied.
+func InOrderChain(orderEvents []model.OrderEvent) []model.OrderEvent {
+	return Chain(inOrder(orderEvents))
+}
+
+// LastInOrderEvent returns the event the orders row is expected to be derived from.
+func LastInOrderEvent(orderEvents []model.OrderEvent) (model.OrderEvent, bool) {
+	chain := InOrderChain(orderEvents)
+	if len(chain) == 0 {
+		return model.OrderEvent{}, false
+	}
+	return chain[len(chain)-1], true
+}
+
+// StateAsOf reconstructs the order projection from events known at asOf on the given timeline.
+// A chinazes order is considered final once it has been finalized and model.ChinazesFinalizationDelay has passed.
+// Other events stored final beyond their status were finalized by an operator, like operator events they keep
+// the stored is_final.
+func StateAsOf(orderEvents []model.OrderEvent, asOf time.Time, timeline model.Timeline) (model.OrderState, bool) {
+	var knownEvents []model.OrderEvent
+	for _, event := range orderEvents {
+		if !timestamp(event, timeline).After(asOf) {
+			knownEvents = append(knownEvents, event)
+		}
+	}
+
+	chain := Chain(knownEvents)
+	if len(chain) == 0 {
+		return model.OrderState{}, false
+	}
+
+	last := chain[len(chain)-1]
+	isFinal := model.StatusToIsFinal[last.OrderStatus] || last.IsFinal
+	if last.OrderStatus == model.StatusChinazes && last.IsFinal && last.OperatorID == "" {
+		isFinal = !timestamp(last, timeline).Add(model.ChinazesFinalizationDelay).After(asOf)
+	}
+
+	order := last.Order
+	order.IsFinal = isFinal
+	return model.OrderState{
+		Order:    order,
+		IsFinal:  isFinal,
+		AsOf:     asOf,
+		Timeline: timeline,
+	}, true
+}
+
+func timestamp(event model.OrderEvent, timeline model.Timeline) time.Time {
+	if timeline == model.TimelineReceivedAt {
+		return event.ReceivedAt
+	}
+	return event.UpdatedAt
+}
+
+func earliestNext(orderEvents []model.OrderEvent, statuses []model.OrderStatus, chain []model.OrderEvent) (model.OrderEvent, bool) {
+	var earliest model.OrderEvent
+	found := false
+	for _, event := range orderEvents {
+		if !slices.Contains(statuses, event.OrderStatus) && !followsAsOperatorEvent(event, chain) {
+			continue
+		}
+		if !found || event.UpdatedAt.Before(earliest.UpdatedAt) {
+			earliest = event
+			found = true
+		}
+	}
+	return earliest, found
+}
+
+// followsAsOperatorEvent reports whether event was created by an operator after the last event of chain and is not
+// part of it yet. Operators move existing orders, so an operator event never starts a chain.
+func followsAsOperatorEvent(event model.OrderEvent, chain []model.OrderEvent) bool {
+	if event.OperatorID == "" || len(chain) == 0 || !event.UpdatedAt.After(chain[len(chain)-1].UpdatedAt) {
+		return false
+	}
+	return !slices.ContainsFunc(chain, func(chained model.OrderEvent) bool {
+		return chained.EventID == event.EventID
+	})
+}
@@ -0,0 +1,264 @@
+package ordering
+
+import (
+	"order-event-processor/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCurrentStatus(t *testing.T) {
+	events := []model.OrderEvent{
+		{Order: model.Order{OrderStatus: model.StatusConfirmedByMayor}, InOrder: false},
+		{Order: model.Order{OrderStatus: model.StatusSbuVerificationPending}, InOrder: true},
+		{Order: model.Order{OrderStatus: model.StatusCoolOrderCreated}, InOrder: true},
+	}
+
+	if status := CurrentStatus(events); status != model.StatusSbuVerificationPending {
+		t.Errorf("expected %s but got %s", model.StatusSbuVerificationPending, status)
+	}
+}
+
+func TestStateAsOf(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(status model.OrderStatus, updatedAt time.Duration, receivedAt time.Duration, isFinal bool) model.OrderEvent {
+		return model.OrderEvent{
+			Order:      model.Order{OrderStatus: status, IsFinal: isFinal, UpdatedAt: start.Add(updatedAt)},
+			InOrder:    true,
+			ReceivedAt: start.Add(receivedAt),
+		}
+	}
+	events := []model.OrderEvent{
+		event(model.StatusCoolOrderCreated, 0, time.Hour, false),
+		event(model.StatusSbuVerificationPending, time.Minute, time.Minute, false),
+		event(model.StatusConfirmedByMayor, 2*time.Minute, 2*time.Minute, false),
+		event(model.StatusChinazes, 3*time.Minute, 3*time.Minute, true),
+	}
+
+	tests := []struct {
+		name           string
+		asOf           time.Duration
+		timeline       model.Timeline
+		expectedExists bool
+		expectedStatus model.OrderStatus
+		expectedFinal  bool
+	}{
+		{"before first event", -time.Second, model.TimelineUpdatedAt, false, "", false},
+		{"after first event", 90 * time.Second, model.TimelineUpdatedAt, true, model.StatusSbuVerificationPending, false},
+		{"predecessor not received yet", 90 * time.Second, model.TimelineReceivedAt, false, "", false},
+		{"chinazes before finalization", 3*time.Minute + time.Second, model.TimelineUpdatedAt, true, model.StatusChinazes, false},
+		{"chinazes after finalization", 4 * time.Minute, model.TimelineUpdatedAt, true, model.StatusChinazes, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state, exists := StateAsOf(events, start.Add(test.asOf), test.timeline)
+			if exists != test.expectedExists {
+				t.Fatalf("expected exists to be %t but got %t", test.expectedExists, exists)
+			}
+			if state.OrderStatus != test.expectedStatus || state.IsFinal != test.expectedFinal {
+				t.Errorf("expected %s (final %t) but got %s (final %t)", test.expectedStatus, test.expectedFinal, state.OrderStatus, state.IsFinal)
+			}
+		})
+	}
+}
+
+func TestStateAsOf_OperatorFinalization(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := model.OrderEvent{
+		EventID:    "1",
+		Order:      model.Order{OrderStatus: model.StatusCoolOrderCreated, UpdatedAt: start},
+		InOrder:    true,
+		ReceivedAt: start,
+	}
+	pending := model.OrderEvent{
+		EventID:    "2",
+		Order:      model.Order{OrderStatus: model.StatusSbuVerificationPending, IsFinal: true, UpdatedAt: start.Add(time.Minute)},
+		InOrder:    true,
+		ReceivedAt: start.Add(time.Minute),
+	}
+	forced := model.OrderEvent{
+		EventID:    "2",
+		Order:      model.Order{OrderStatus: model.StatusChinazes, IsFinal: true, UpdatedAt: start.Add(time.Minute)},
+		InOrder:    true,
+		ReceivedAt: start.Add(time.Minute),
+		OperatorID: "support",
+	}
+
+	tests := []struct {
+		name   string
+		events []model.OrderEvent
+	}{
+		{"finalized by an operator", []model.OrderEvent{created, pending}},
+		{"forced and finalized by an operator", []model.OrderEvent{created, forced}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			last := test.events[len(test.events)-1]
+			state, exists := StateAsOf(test.events, start.Add(time.Minute+time.Second), model.TimelineReceivedAt)
+			if !exists || state.OrderStatus != last.OrderStatus || !state.IsFinal {
+				t.Errorf("expected final %s but got %+v (exists %t)", last.OrderStatus, state, exists)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(id string, status model.OrderStatus, receivedAt time.Duration) model.OrderEvent {
+		return model.OrderEvent{
+			EventID:    id,
+			Order:      model.Order{OrderStatus: status, UpdatedAt: start.Add(receivedAt)},
+			InOrder:    true,
+			ReceivedAt: start.Add(receivedAt),
+		}
+	}
+
+	replayed := Replay([]model.OrderEvent{
+		event("3", model.StatusConfirmedByMayor, 3*time.Minute),
+		event("1", model.StatusCoolOrderCreated, time.Minute),
+		event("2", model.StatusSbuVerificationPending, 2*time.Minute),
+		event("4", model.StatusChinazes, 4*time.Minute),
+		event("5", model.StatusChangedMyMind, 6*time.Minute),
+	}, start.Add(time.Hour))
+
+	if replayed.Order == nil || replayed.Order.OrderStatus != model.StatusChinazes || !replayed.Order.IsFinal {
+		t.Fatalf("expected final chinazes order but got %+v", replayed.Order)
+	}
+	if len(replayed.Rejected) != 1 || replayed.Rejected[0].EventID != "5" {
+		t.Errorf("expected event 5 to be rejected but got %+v", replayed.Rejected)
+	}
+}
+
+func TestReplay_KeepsOperatorChanges(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := model.OrderEvent{
+		EventID:    "1",
+		Order:      model.Order{OrderStatus: model.StatusCoolOrderCreated, UpdatedAt: start},
+		InOrder:    true,
+		ReceivedAt: start,
+	}
+	// forced from cool_order_created and finalized by an operator afterwards
+	forced := model.OrderEvent{
+		EventID:    "2",
+		Order:      model.Order{OrderStatus: model.StatusConfirmedByMayor, IsFinal: true, UpdatedAt: start.Add(time.Millisecond)},
+		InOrder:    true,
+		ReceivedAt: start.Add(time.Hour),
+		OperatorID: "support",
+	}
+
+	replayed := Replay([]model.OrderEvent{forced, created}, start.Add(2*time.Hour))
+
+	if replayed.Order == nil || replayed.Order.OrderStatus != model.StatusConfirmedByMayor || !replayed.Order.IsFinal {
+		t.Fatalf("expected final confirmed_by_mayor order but got %+v", replayed.Order)
+	}
+	for _, event := range replayed.Events {
+		if !event.InOrder || event.IsFinal != (event.EventID == "2") {
+			t.Errorf("expected stored flags to be kept but got %+v", event)
+		}
+	}
+}
+
+func TestChain_FollowsOperatorEvents(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(eventId string, status model.OrderStatus, updatedAt time.Duration, operatorId string) model.OrderEvent {
+		return model.OrderEvent{
+			EventID:    eventId,
+			Order:      model.Order{OrderStatus: status, UpdatedAt: start.Add(updatedAt)},
+			OperatorID: operatorId,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		events   []model.OrderEvent
+		expected []string
+	}{
+		{
+			name: "operator event skips a missing status",
+			events: []model.OrderEvent{
+				event("1", model.StatusCoolOrderCreated, 0, ""),
+				event("2", model.StatusConfirmedByMayor, 2*time.Minute, "operator"),
+			},
+			expected: []string{"1", "2"},
+		},
+		{
+			name: "buffered event follows the operator event it waited for",
+			events: []model.OrderEvent{
+				event("1", model.StatusCoolOrderCreated, 0, ""),
+				event("2", model.StatusSbuVerificationPending, time.Minute, ""),
+				event("3", model.StatusConfirmedByMayor, 3*time.Minute, "operator"),
+				event("4", model.StatusChinazes, 2*time.Minute, ""),
+			},
+			expected: []string{"1", "2", "3", "4"},
+		},
+		{
+			name: "operator event needs an order to move",
+			events: []model.OrderEvent{
+				event("1", model.StatusConfirmedByMayor, 0, "operator"),
+			},
+		},
+		{
+			name: "operator event updated before the chain is ignored",
+			events: []model.OrderEvent{
+				event("1", model.StatusCoolOrderCreated, time.Minute, ""),
+				event("2", model.StatusChinazes, 0, "operator"),
+			},
+			expected: []string{"1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var eventIds []string
+			for _, event := range Chain(test.events) {
+				eventIds = append(eventIds, event.EventID)
+			}
+			if !slices.Equal(eventIds, test.expected) {
+				t.Errorf("expected chain %v but got %v", test.expected, eventIds)
+			}
+		})
+	}
+}
+
+func BenchmarkUpdatedInOrderEvents(b *testing.B) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor, model.StatusChinazes, model.StatusGiveMyMoneyBack}
+	lifecycle := make([]model.OrderEvent, 0, len(statuses))
+	for i, status := range statuses {
+		lifecycle = append(lifecycle, model.OrderEvent{Order: model.Order{OrderStatus: status, UpdatedAt: start.Add(time.Duration(i) * time.Minute)}})
+	}
+
+	tests := []struct {
+		name   string
+		stored []model.OrderEvent
+		next   model.OrderEvent
+	}{
+		{"in order", markedInOrder(lifecycle[:4]), lifecycle[4]},
+		{"fills gap", append(markedInOrder(lifecycle[:1]), lifecycle[2:]...), lifecycle[1]},
+		{"out of order", markedInOrder(lifecycle[:1]), lifecycle[4]},
+	}
+
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			events := make([]model.OrderEvent, len(test.stored)+1)
+			for i := 0; i < b.N; i++ {
+				// UpdatedInOrderEvents sorts its argument, so every iteration starts from the same order
+				copy(events, test.stored)
+				events[len(events)-1] = test.next
+				if _, err := UpdatedInOrderEvents(events); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func markedInOrder(events []model.OrderEvent) []model.OrderEvent {
+	marked := make([]model.OrderEvent, 0, len(events))
+	for _, event := range events {
+		event.InOrder = true
+		marked = append(marked, event)
+	}
+	return marked
+}
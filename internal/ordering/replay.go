@@ -0,0 +1,119 @@
+package ordering
+
+import (
+	"order-event-processor/internal/model"
+	"slices"
+	"sort"
+	"time"
+)
+
+type Replayed struct {
+	// Events are all events of the order with recomputed is_in_order and is_final.
+	Events []model.OrderEvent
+	// Order is the recomputed projection, nil if no event is in order.
+	Order *model.Order
+	// Rejected are events that would have been refused had they been received in this order.
+	Rejected []model.OrderEvent
+}
+
+// Replay recomputes an order from scratch by feeding its events one by one in received_at order
+// through UpdatedInOrderEvents, the same way the webhook handler applies them. A chinazes event becomes final
+// model.ChinazesFinalizationDelay after it was applied unless give_my_money_back was received by then.
+// Events stored final stay final, an operator may have finalized them, and events following them are no longer
+// in order.
+func Replay(orderEvents []model.OrderEvent, now time.Time) Replayed {
+	received := slices.Clone(orderEvents)
+	storedFinal := make(map[string]bool, len(received))
+	for i := range received {
+		storedFinal[received[i].EventID] = received[i].IsFinal
+		received[i].InOrder = false
+		received[i].IsFinal = false
+	}
+	sort.SliceStable(received, func(i, j int) bool {
+		return received[i].ReceivedAt.Before(received[j].ReceivedAt)
+	})
+
+	var replayed Replayed
+	var known []model.OrderEvent
+	appliedAt := make(map[string]time.Time)
+	for _, event := range received {
+		finalizeChinazes(known, appliedAt, event.ReceivedAt)
+		if isFinalAndInOrder(known) {
+			replayed.Rejected = append(replayed.Rejected, event)
+			continue
+		}
+
+		changed, err := UpdatedInOrderEvents(append(slices.Clone(known), event))
+		if err != nil {
+			replayed.Rejected = append(replayed.Rejected, event)
+			continue
+		}
+
+		known = append(known, event)
+		for _, changedEvent := range changed {
+			index := slices.IndexFunc(known, func(e model.OrderEvent) bool {
+				return e.EventID == changedEvent.EventID
+			})
+			known[index] = changedEvent
+			appliedAt[changedEvent.EventID] = event.ReceivedAt
+		}
+	}
+	finalizeChinazes(known, appliedAt, now)
+	keepFinalized(known, storedFinal)
+
+	replayed.Events = known
+	if last, ok := LastInOrderEvent(known); ok {
+		replayed.Order = &last.Order
+	}
+	return replayed
+}
+
+func finalizeChinazes(known []model.OrderEvent, appliedAt map[string]time.Time, at time.Time) {
+	moneyBackReceived := slices.ContainsFunc(known, func(e model.OrderEvent) bool {
+		return e.OrderStatus == model.StatusGiveMyMoneyBack
+	})
+	if moneyBackReceived {
+		return
+	}
+	for i, event := range known {
+		if event.InOrder && event.OrderStatus == model.StatusChinazes && !appliedAt[event.EventID].Add(model.ChinazesFinalizationDelay).After(at) {
+			known[i].IsFinal = true
+		}
+	}
+}
+
+// keepFinalized makes in order events final again if they were stored final, events after the first final one
+// in the chain are no longer in order.
+func keepFinalized(known []model.OrderEvent, storedFinal map[string]bool) {
+	finalized := false
+	for _, chained := range InOrderChain(known) {
+		index := slices.IndexFunc(known, func(e model.OrderEvent) bool {
+			return e.EventID == chained.EventID
+		})
+		if finalized {
+			known[index].InOrder = false
+			known[index].IsFinal = false
+			continue
+		}
+		if storedFinal[chained.EventID] {
+			known[index].IsFinal = true
+		}
+		finalized = known[index].IsFinal
+	}
+}
+
+func isFinalAndInOrder(known []model.OrderEvent) bool {
+	return slices.ContainsFunc(known, func(e model.OrderEvent) bool {
+		return e.InOrder && e.IsFinal
+	})
+}
+
+func inOrder(orderEvents []model.OrderEvent) []model.OrderEvent {
+	var inOrderEvents []model.OrderEvent
+	for _, event := range orderEvents {
+		if event.InOrder {
+			inOrderEvents = append(inOrderEvents, event)
+		}
+	}
+	return inOrderEvents
+}
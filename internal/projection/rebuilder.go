@@ -0,0 +1,179 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"slices"
+	"sort"
+	"sync"
+)
+
+type Storage interface {
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	GetAllOrderIds(ctx context.Context) ([]string, error)
+	GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error)
+	GetOrder(ctx context.Context, orderId string) (model.Order, error)
+	UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, orderEvents ...model.OrderEvent) error
+	InsertOrUpdateOrder(ctx context.Context, order model.Order) error
+	DeleteOrder(ctx context.Context, orderId string) error
+}
+
+// Rebuilder recomputes is_in_order and is_final of order_events and the orders table by replaying events of every order.
+type Rebuilder struct {
+	log       *slog.Logger
+	storage   Storage
+	batchSize int
+	workers   int
+	clock     clock.Clock
+}
+
+func NewRebuilder(log *slog.Logger, storage Storage, batchSize int, workers int, clock clock.Clock) *Rebuilder {
+	return &Rebuilder{
+		log:       log,
+		storage:   storage,
+		batchSize: max(batchSize, 1),
+		workers:   max(workers, 1),
+		clock:     clock,
+	}
+}
+
+// Rebuild processes orders in batches of batchSize with workers batches in parallel. With dryRun nothing is written,
+// the returned report contains differences between stored and recomputed state either way.
+func (r *Rebuilder) Rebuild(ctx context.Context, dryRun bool) (model.RebuildReport, error) {
+	orderIds, err := r.storage.GetAllOrderIds(ctx)
+	if err != nil {
+		return model.RebuildReport{}, err
+	}
+
+	batches := make(chan []string)
+	go func() {
+		for start := 0; start < len(orderIds); start += r.batchSize {
+			batches <- orderIds[start:min(start+r.batchSize, len(orderIds))]
+		}
+		close(batches)
+	}()
+
+	report := model.RebuildReport{DryRun: dryRun, OrdersScanned: len(orderIds)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				for _, orderId := range batch {
+					diff, changed, err := r.RebuildOrder(ctx, orderId, dryRun)
+					mutex.Lock()
+					if err != nil {
+						r.log.Error("error while rebuilding order", "order_id", orderId, "error", err)
+						report.Failed = append(report.Failed, orderId)
+					} else if changed || len(diff.RejectedEvents) > 0 {
+						if changed {
+							report.OrdersChanged++
+						}
+						report.Diffs = append(report.Diffs, diff)
+					}
+					mutex.Unlock()
+				}
+				r.log.Debug("rebuilt batch of orders", "size", len(batch))
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(report.Diffs, func(i, j int) bool {
+		return report.Diffs[i].OrderID < report.Diffs[j].OrderID
+	})
+	sort.Strings(report.Failed)
+	return report, nil
+}
+
+// RebuildOrder replays events of a single order under its lock and returns the difference with the stored state.
+func (r *Rebuilder) RebuildOrder(ctx context.Context, orderId string, dryRun bool) (model.OrderDiff, bool, error) {
+	var diff model.OrderDiff
+	var changed bool
+	err := r.storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := r.storage.AcquireLock(ctx, orderId); err != nil {
+			return err
+		}
+
+		events, err := r.storage.GetAllEventsByOrderId(ctx, orderId)
+		if err != nil {
+			return err
+		}
+		var before *model.Order
+		order, err := r.storage.GetOrder(ctx, orderId)
+		if err == nil {
+			before = &order
+		} else if !errors.Is(err, storage.OrderNotFound) {
+			return err
+		}
+
+		replayed := ordering.Replay(events, r.clock.Now())
+		var changedEvents []model.OrderEvent
+		diff, changedEvents = diffOf(orderId, events, before, replayed)
+		changed = len(diff.Events) > 0 || diff.OrderBefore != nil || diff.OrderAfter != nil
+		if dryRun || !changed {
+			return nil
+		}
+
+		if err := r.storage.UpdateOrderEventsIsInOrderAndIsFinal(ctx, changedEvents...); err != nil {
+			return err
+		}
+		if replayed.Order == nil {
+			return r.storage.DeleteOrder(ctx, orderId)
+		} else if diff.OrderAfter != nil {
+			return r.storage.InsertOrUpdateOrder(ctx, *replayed.Order)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.OrderDiff{}, false, err
+	}
+	return diff, changed, nil
+}
+
+func diffOf(orderId string, events []model.OrderEvent, before *model.Order, replayed ordering.Replayed) (model.OrderDiff, []model.OrderEvent) {
+	diff := model.OrderDiff{OrderID: orderId}
+
+	eventIdToStored := make(map[string]model.OrderEvent, len(events))
+	for _, event := range events {
+		eventIdToStored[event.EventID] = event
+	}
+	var changedEvents []model.OrderEvent
+	for _, event := range slices.Concat(replayed.Events, replayed.Rejected) {
+		stored := eventIdToStored[event.EventID]
+		if stored.InOrder != event.InOrder || stored.IsFinal != event.IsFinal {
+			diff.Events = append(diff.Events, model.EventDiff{
+				EventID:       event.EventID,
+				InOrderBefore: stored.InOrder,
+				InOrderAfter:  event.InOrder,
+				IsFinalBefore: stored.IsFinal,
+				IsFinalAfter:  event.IsFinal,
+			})
+			changedEvents = append(changedEvents, event)
+		}
+	}
+	for _, event := range replayed.Rejected {
+		diff.RejectedEvents = append(diff.RejectedEvents, event.EventID)
+	}
+
+	if len(mismatchedFields(before, replayed.Order)) > 0 {
+		diff.OrderBefore = toOrderRow(before)
+		diff.OrderAfter = toOrderRow(replayed.Order)
+	}
+	return diff, changedEvents
+}
+
+func toOrderRow(order *model.Order) *model.OrderRow {
+	if order == nil {
+		return nil
+	}
+	return &model.OrderRow{Order: *order, IsFinal: order.IsFinal}
+}
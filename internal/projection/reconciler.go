@@ -0,0 +1,219 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/lib/metrics"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	mismatchesGauge = metrics.NewGauge("order_projection_mismatches",
+		"Orders rows differing from the last in order event of their order, updated on every reconciliation.")
+	repairedCounter = metrics.NewCounter("order_projection_repairs_total",
+		"Orders rows repaired by reconciliation.")
+	reconciledAtGauge = metrics.NewGauge("order_projection_last_reconciliation_timestamp_seconds",
+		"Unix time of the last reconciliation.")
+)
+
+type ReconcilerStorage interface {
+	RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error
+	AcquireLock(ctx context.Context, id string) error
+	GetAllOrders(ctx context.Context) ([]model.Order, error)
+	GetAllInOrderEvents(ctx context.Context) ([]model.OrderEvent, error)
+	GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error)
+	GetOrder(ctx context.Context, orderId string) (model.Order, error)
+	InsertOrUpdateOrder(ctx context.Context, order model.Order) error
+	DeleteOrder(ctx context.Context, orderId string) error
+}
+
+// Reconciler compares every orders row with the last in order event of the order and optionally repairs mismatches.
+type Reconciler struct {
+	log        *slog.Logger
+	storage    ReconcilerStorage
+	autoRepair atomic.Bool
+	clock      clock.Clock
+}
+
+func NewReconciler(log *slog.Logger, storage ReconcilerStorage, autoRepair bool, clock clock.Clock) *Reconciler {
+	r := &Reconciler{
+		log:     log,
+		storage: storage,
+		clock:   clock,
+	}
+	r.SetAutoRepair(autoRepair)
+	return r
+}
+
+// SetAutoRepair applies from the next reconciliation.
+func (r *Reconciler) SetAutoRepair(autoRepair bool) {
+	r.autoRepair.Store(autoRepair)
+}
+
+func (r *Reconciler) Check(ctx context.Context) (model.ReconciliationReport, error) {
+	orders, err := r.storage.GetAllOrders(ctx)
+	if err != nil {
+		return model.ReconciliationReport{}, err
+	}
+	events, err := r.storage.GetAllInOrderEvents(ctx)
+	if err != nil {
+		return model.ReconciliationReport{}, err
+	}
+
+	orderIdToStored := make(map[string]*model.Order, len(orders))
+	for _, order := range orders {
+		orderIdToStored[order.OrderID] = &order
+	}
+	orderIdToEvents := make(map[string][]model.OrderEvent)
+	for _, event := range events {
+		orderIdToEvents[event.OrderID] = append(orderIdToEvents[event.OrderID], event)
+		if _, ok := orderIdToStored[event.OrderID]; !ok {
+			orderIdToStored[event.OrderID] = nil
+		}
+	}
+
+	report := model.ReconciliationReport{CheckedAt: r.clock.Now(), OrdersChecked: len(orderIdToStored)}
+	for orderId, stored := range orderIdToStored {
+		if mismatch, ok := mismatchOf(orderId, stored, orderIdToEvents[orderId]); ok {
+			report.Mismatches = append(report.Mismatches, mismatch)
+		}
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		return report.Mismatches[i].OrderID < report.Mismatches[j].OrderID
+	})
+
+	mismatchesGauge.Set(float64(len(report.Mismatches)))
+	reconciledAtGauge.Set(float64(report.CheckedAt.UnixNano()) / float64(time.Second))
+	return report, nil
+}
+
+// Reconcile checks all orders and, if auto repair is enabled, repairs mismatched ones.
+func (r *Reconciler) Reconcile(ctx context.Context) (model.ReconciliationReport, error) {
+	report, err := r.Check(ctx)
+	if err != nil || !r.autoRepair.Load() {
+		return report, err
+	}
+
+	for i, mismatch := range report.Mismatches {
+		repaired, err := r.Repair(ctx, mismatch.OrderID)
+		if err != nil {
+			r.log.Error("error while repairing order", "order_id", mismatch.OrderID, "error", err)
+			continue
+		}
+		report.Mismatches[i].Repaired = repaired
+	}
+	return report, nil
+}
+
+// Repair rechecks the order under its lock, since it might have changed after Check, and overwrites the orders row
+// with the state of the last in order event.
+func (r *Reconciler) Repair(ctx context.Context, orderId string) (bool, error) {
+	var mismatch model.OrderMismatch
+	var repaired bool
+	err := r.storage.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := r.storage.AcquireLock(ctx, orderId); err != nil {
+			return err
+		}
+
+		events, err := r.storage.GetAllEventsByOrderId(ctx, orderId)
+		if err != nil {
+			return err
+		}
+		var stored *model.Order
+		order, err := r.storage.GetOrder(ctx, orderId)
+		if err == nil {
+			stored = &order
+		} else if !errors.Is(err, storage.OrderNotFound) {
+			return err
+		}
+
+		mismatch, repaired = mismatchOf(orderId, stored, events)
+		if !repaired {
+			return nil
+		} else if mismatch.Expected == nil {
+			return r.storage.DeleteOrder(ctx, orderId)
+		}
+		expected := mismatch.Expected.Order
+		expected.IsFinal = mismatch.Expected.IsFinal
+		return r.storage.InsertOrUpdateOrder(ctx, expected)
+	})
+	if err != nil {
+		return false, err
+	}
+	if repaired {
+		repairedCounter.Inc()
+		r.log.Warn("repaired order projection", "order_id", orderId, "fields", mismatch.Fields)
+	}
+	return repaired, nil
+}
+
+// Run reconciles every interval until ctx is done, a reconciliation in progress is finished first.
+// interval is read before every wait, so a reloaded value applies after the pending wait.
+func (r *Reconciler) Run(ctx context.Context, interval func() time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(interval()):
+		}
+		report, err := r.Reconcile(context.Background())
+		if err != nil {
+			r.log.Error("error while reconciling orders", "error", err)
+			continue
+		}
+		if len(report.Mismatches) > 0 {
+			r.log.Warn("found order projection mismatches", "count", len(report.Mismatches), "auto_repair", r.autoRepair.Load())
+		}
+	}
+}
+
+func mismatchOf(orderId string, stored *model.Order, events []model.OrderEvent) (model.OrderMismatch, bool) {
+	var expected *model.Order
+	if last, ok := ordering.LastInOrderEvent(events); ok {
+		expected = &last.Order
+	}
+
+	fields := mismatchedFields(stored, expected)
+	if len(fields) == 0 {
+		return model.OrderMismatch{}, false
+	}
+	return model.OrderMismatch{
+		OrderID:  orderId,
+		Stored:   toOrderRow(stored),
+		Expected: toOrderRow(expected),
+		Fields:   fields,
+	}, true
+}
+
+func mismatchedFields(stored *model.Order, expected *model.Order) []string {
+	if stored == nil && expected == nil {
+		return nil
+	} else if stored == nil || expected == nil {
+		return []string{"order_id"}
+	}
+
+	var fields []string
+	if stored.UserID != expected.UserID {
+		fields = append(fields, "user_id")
+	}
+	if stored.OrderStatus != expected.OrderStatus {
+		fields = append(fields, "order_status")
+	}
+	if stored.IsFinal != expected.IsFinal {
+		fields = append(fields, "is_final")
+	}
+	if !stored.UpdatedAt.Equal(expected.UpdatedAt) {
+		fields = append(fields, "updated_at")
+	}
+	if !stored.CreatedAt.Equal(expected.CreatedAt) {
+		fields = append(fields, "created_at")
+	}
+	return fields
+}
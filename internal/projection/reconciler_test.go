@@ -0,0 +1,34 @@
+package projection
+
+import (
+	"order-event-processor/internal/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMismatchOf(t *testing.T) {
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+	order := model.Order{OrderID: "order", UserID: "user", OrderStatus: model.StatusSbuVerificationPending, UpdatedAt: updatedAt, CreatedAt: createdAt}
+	events := []model.OrderEvent{
+		{EventID: "1", Order: model.Order{OrderID: "order", UserID: "user", OrderStatus: model.StatusCoolOrderCreated, UpdatedAt: createdAt, CreatedAt: createdAt}, InOrder: true},
+		{EventID: "2", Order: order, InOrder: true},
+		{EventID: "3", Order: model.Order{OrderID: "order", UserID: "user", OrderStatus: model.StatusChinazes}, InOrder: false},
+	}
+
+	if mismatch, ok := mismatchOf("order", &order, events); ok {
+		t.Errorf("expected no mismatch but got %+v", mismatch)
+	}
+
+	swapped := order
+	swapped.UpdatedAt, swapped.CreatedAt = order.CreatedAt, order.UpdatedAt
+	mismatch, ok := mismatchOf("order", &swapped, events)
+	if !ok || !slices.Equal(mismatch.Fields, []string{"updated_at", "created_at"}) {
+		t.Errorf("expected updated_at and created_at mismatch but got %+v", mismatch)
+	}
+
+	if _, ok := mismatchOf("order", nil, events); !ok {
+		t.Errorf("expected missing orders row to be a mismatch")
+	}
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/model"
+	"slices"
+	"time"
+)
+
+type Storage interface {
+	GetEventTimingsSince(ctx context.Context, since time.Time) ([]model.EventTiming, error)
+}
+
+type Service struct {
+	storage Storage
+	clock   clock.Clock
+}
+
+func NewService(storage Storage, clock clock.Clock) *Service {
+	return &Service{
+		storage: storage,
+		clock:   clock,
+	}
+}
+
+// GetEventStats summarizes delivery lag and buffering delay of events received within window.
+func (s *Service) GetEventStats(ctx context.Context, window time.Duration) (model.EventStats, error) {
+	since := s.clock.Now().UTC().Add(-window)
+	timings, err := s.storage.GetEventTimingsSince(ctx, since)
+	if err != nil {
+		return model.EventStats{}, err
+	}
+
+	var deliveryLags, bufferingDelays []time.Duration
+	notApplied := 0
+	for _, timing := range timings {
+		deliveryLags = append(deliveryLags, timing.ReceivedAt.Sub(timing.UpdatedAt))
+		if timing.AppliedAt == nil {
+			notApplied++
+			continue
+		}
+		bufferingDelays = append(bufferingDelays, timing.AppliedAt.Sub(timing.ReceivedAt))
+	}
+
+	return model.EventStats{
+		Since:               since,
+		ProviderDeliveryLag: Summarize(deliveryLags),
+		BufferingDelay:      Summarize(bufferingDelays),
+		NotAppliedEvents:    notApplied,
+	}, nil
+}
+
+// Summarize sorts durations in place and returns their percentiles.
+func Summarize(durations []time.Duration) model.LatencySummary {
+	if len(durations) == 0 {
+		return model.LatencySummary{}
+	}
+	slices.Sort(durations)
+	return model.LatencySummary{
+		Count: len(durations),
+		P50:   percentile(durations, 0.50),
+		P90:   percentile(durations, 0.90),
+		P95:   percentile(durations, 0.95),
+		P99:   percentile(durations, 0.99),
+		Max:   durations[len(durations)-1].Seconds(),
+	}
+}
+
+// percentile uses the nearest rank method, sorted must not be empty.
+func percentile(sorted []time.Duration, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)].Seconds()
+}
@@ -0,0 +1,22 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	var durations []time.Duration
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	summary := Summarize(durations)
+	if summary.Count != 100 || summary.P50 != 50 || summary.P90 != 90 || summary.P99 != 99 || summary.Max != 100 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if empty := Summarize(nil); empty.Count != 0 {
+		t.Errorf("expected empty summary but got %+v", empty)
+	}
+}
@@ -0,0 +1,292 @@
+package faulty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-event-processor/internal/admin"
+	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/buffer"
+	"order-event-processor/internal/handler"
+	"order-event-processor/internal/health"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/projection"
+	"order-event-processor/internal/stats"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInjected    = errors.New("injected fault")
+	ErrLockTimeout = errors.New("injected lock timeout")
+)
+
+// Wrapped is the storage Storage decorates, it has the methods of app.Storage.
+type Wrapped interface {
+	handler.OrderEventRepository
+	admin.Storage
+	handler.OrdersFinder
+	health.Pinger
+	broadcaster.FromDbEventProducerStorage
+	buffer.Storage
+	projection.Storage
+	projection.ReconcilerStorage
+	stats.Storage
+}
+
+var _ Wrapped = (*Storage)(nil)
+
+var methods = methodsOf(reflect.TypeOf((*Wrapped)(nil)).Elem())
+
+// Storage passes calls to the wrapped storage unless a fault is set for the called method,
+// it is meant for tests and non-production environments.
+type Storage struct {
+	storage Wrapped
+	mutex   sync.Mutex
+	faults  []model.StorageFault
+}
+
+func New(storage Wrapped) *Storage {
+	return &Storage{
+		storage: storage,
+	}
+}
+
+// SetFaults replaces all faults, call counts start from zero.
+func (s *Storage) SetFaults(faults []model.StorageFault) error {
+	for _, fault := range faults {
+		if !methods[fault.Method] {
+			return fmt.Errorf("unknown storage method %s", fault.Method)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = make([]model.StorageFault, len(faults))
+	for i, fault := range faults {
+		fault.Calls = 0
+		s.faults[i] = fault
+	}
+	return nil
+}
+
+func (s *Storage) Faults() []model.StorageFault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	faults := make([]model.StorageFault, len(s.faults))
+	copy(faults, s.faults)
+	return faults
+}
+
+// inject counts the call in every fault of method and applies the first one that is active.
+func (s *Storage) inject(ctx context.Context, method string) error {
+	var active *model.StorageFault
+	s.mutex.Lock()
+	for i := range s.faults {
+		fault := &s.faults[i]
+		if fault.Method != method {
+			continue
+		}
+		fault.Calls++
+		if active == nil && fault.Calls > fault.After && (fault.Times == 0 || fault.Calls <= fault.After+fault.Times) {
+			applied := *fault
+			active = &applied
+		}
+	}
+	s.mutex.Unlock()
+	if active == nil {
+		return nil
+	}
+
+	if active.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(active.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if active.LockTimeout {
+		return fmt.Errorf("%s: %w", method, ErrLockTimeout)
+	}
+	if active.Error != "" {
+		return fmt.Errorf("%s: %w: %s", method, ErrInjected, active.Error)
+	}
+	return nil
+}
+
+func methodsOf(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumMethod())
+	for i := 0; i < t.NumMethod(); i++ {
+		names[t.Method(i).Name] = true
+	}
+	return names
+}
+
+func (s *Storage) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	if err := s.inject(ctx, "RunInTransaction"); err != nil {
+		return err
+	}
+	return s.storage.RunInTransaction(ctx, run)
+}
+
+func (s *Storage) AcquireLock(ctx context.Context, id string) error {
+	if err := s.inject(ctx, "AcquireLock"); err != nil {
+		return err
+	}
+	return s.storage.AcquireLock(ctx, id)
+}
+
+func (s *Storage) SaveOrderEvent(ctx context.Context, event model.OrderEvent) error {
+	if err := s.inject(ctx, "SaveOrderEvent"); err != nil {
+		return err
+	}
+	return s.storage.SaveOrderEvent(ctx, event)
+}
+
+func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, events ...model.OrderEvent) error {
+	if err := s.inject(ctx, "InsertOrderEventsOrUpdateIsInOrder"); err != nil {
+		return err
+	}
+	return s.storage.InsertOrderEventsOrUpdateIsInOrder(ctx, events...)
+}
+
+func (s *Storage) UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, events ...model.OrderEvent) error {
+	if err := s.inject(ctx, "UpdateOrderEventsIsInOrderAndIsFinal"); err != nil {
+		return err
+	}
+	return s.storage.UpdateOrderEventsIsInOrderAndIsFinal(ctx, events...)
+}
+
+func (s *Storage) UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error {
+	if err := s.inject(ctx, "UpdateOrderEventFinalStatus"); err != nil {
+		return err
+	}
+	return s.storage.UpdateOrderEventFinalStatus(ctx, eventId)
+}
+
+func (s *Storage) DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (int64, error) {
+	if err := s.inject(ctx, "DeadLetterOrderEvents"); err != nil {
+		return 0, err
+	}
+	return s.storage.DeadLetterOrderEvents(ctx, reason, eventIds...)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(ctx context.Context, orderId string) (bool, error) {
+	if err := s.inject(ctx, "ExistsOrderEventForOrderIdFinalAndInOrder"); err != nil {
+		return false, err
+	}
+	return s.storage.ExistsOrderEventForOrderIdFinalAndInOrder(ctx, orderId)
+}
+
+func (s *Storage) ExistsOrderEventWithEventId(ctx context.Context, eventId string) (bool, error) {
+	if err := s.inject(ctx, "ExistsOrderEventWithEventId"); err != nil {
+		return false, err
+	}
+	return s.storage.ExistsOrderEventWithEventId(ctx, eventId)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdWithStatus(ctx context.Context, orderId string, orderStatus model.OrderStatus) (bool, error) {
+	if err := s.inject(ctx, "ExistsOrderEventForOrderIdWithStatus"); err != nil {
+		return false, err
+	}
+	return s.storage.ExistsOrderEventForOrderIdWithStatus(ctx, orderId, orderStatus)
+}
+
+func (s *Storage) GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error) {
+	if err := s.inject(ctx, "GetAllEventsByOrderId"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetAllEventsByOrderId(ctx, orderId)
+}
+
+func (s *Storage) GetAllInOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	if err := s.inject(ctx, "GetAllInOrderEvents"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetAllInOrderEvents(ctx)
+}
+
+func (s *Storage) GetEventsOfOrdersWithOutOfOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	if err := s.inject(ctx, "GetEventsOfOrdersWithOutOfOrderEvents"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetEventsOfOrdersWithOutOfOrderEvents(ctx)
+}
+
+func (s *Storage) GetEventTimingsSince(ctx context.Context, since time.Time) ([]model.EventTiming, error) {
+	if err := s.inject(ctx, "GetEventTimingsSince"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetEventTimingsSince(ctx, since)
+}
+
+func (s *Storage) InsertOrUpdateOrder(ctx context.Context, order model.Order) error {
+	if err := s.inject(ctx, "InsertOrUpdateOrder"); err != nil {
+		return err
+	}
+	return s.storage.InsertOrUpdateOrder(ctx, order)
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, orderId string) error {
+	if err := s.inject(ctx, "DeleteOrder"); err != nil {
+		return err
+	}
+	return s.storage.DeleteOrder(ctx, orderId)
+}
+
+func (s *Storage) DeleteOrderEvent(ctx context.Context, eventId string) error {
+	if err := s.inject(ctx, "DeleteOrderEvent"); err != nil {
+		return err
+	}
+	return s.storage.DeleteOrderEvent(ctx, eventId)
+}
+
+func (s *Storage) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+	if err := s.inject(ctx, "InsertAuditEntry"); err != nil {
+		return err
+	}
+	return s.storage.InsertAuditEntry(ctx, entry)
+}
+
+func (s *Storage) GetAuditEntries(ctx context.Context, orderId string) ([]model.AuditEntry, error) {
+	if err := s.inject(ctx, "GetAuditEntries"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetAuditEntries(ctx, orderId)
+}
+
+func (s *Storage) GetOrder(ctx context.Context, orderId string) (model.Order, error) {
+	if err := s.inject(ctx, "GetOrder"); err != nil {
+		return model.Order{}, err
+	}
+	return s.storage.GetOrder(ctx, orderId)
+}
+
+func (s *Storage) GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (model.OrderState, error) {
+	if err := s.inject(ctx, "GetOrderAsOf"); err != nil {
+		return model.OrderState{}, err
+	}
+	return s.storage.GetOrderAsOf(ctx, orderId, asOf, timeline)
+}
+
+func (s *Storage) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	if err := s.inject(ctx, "GetAllOrders"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetAllOrders(ctx)
+}
+
+func (s *Storage) GetAllOrderIds(ctx context.Context) ([]string, error) {
+	if err := s.inject(ctx, "GetAllOrderIds"); err != nil {
+		return nil, err
+	}
+	return s.storage.GetAllOrderIds(ctx)
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	if err := s.inject(ctx, "Ping"); err != nil {
+		return err
+	}
+	return s.storage.Ping(ctx)
+}
@@ -0,0 +1,82 @@
+package faulty
+
+import (
+	"context"
+	"errors"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage/memory"
+	"testing"
+	"time"
+)
+
+func TestStorage_AfterAndTimes(t *testing.T) {
+	s := New(memory.New())
+	err := s.SetFaults([]model.StorageFault{{Method: "GetAllOrders", Error: "connection reset", After: 1, Times: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []bool{false, true, true, false}
+	for i, fails := range expected {
+		_, err := s.GetAllOrders(context.Background())
+		if fails != errors.Is(err, ErrInjected) {
+			t.Errorf("call %d: expected injected error %t but got %v", i+1, fails, err)
+		}
+	}
+	if calls := s.Faults()[0].Calls; calls != len(expected) {
+		t.Errorf("expected %d calls but got %d", len(expected), calls)
+	}
+}
+
+func TestStorage_LockTimeoutWaitsLatency(t *testing.T) {
+	s := New(memory.New())
+	err := s.SetFaults([]model.StorageFault{{Method: "AcquireLock", LockTimeout: true, LatencyMs: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	err = s.RunInTransaction(context.Background(), func(ctx context.Context) error {
+		return s.AcquireLock(ctx, "order")
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected lock timeout but got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 20*time.Millisecond {
+		t.Errorf("expected lock timeout after latency but it took %s", elapsed)
+	}
+}
+
+func TestStorage_FailureRollsBackTransaction(t *testing.T) {
+	s := New(memory.New())
+	err := s.SetFaults([]model.StorageFault{{Method: "InsertOrUpdateOrder", Error: "connection reset"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := model.OrderEvent{EventID: "event", Order: model.Order{OrderID: "order", OrderStatus: model.StatusCoolOrderCreated}, InOrder: true}
+	err = s.RunInTransaction(context.Background(), func(ctx context.Context) error {
+		if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, event); err != nil {
+			return err
+		}
+		return s.InsertOrUpdateOrder(ctx, event.Order)
+	})
+	if !errors.Is(err, ErrInjected) {
+		t.Fatalf("expected injected error but got %v", err)
+	}
+
+	exists, err := s.ExistsOrderEventWithEventId(context.Background(), "event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("expected the event insert to be rolled back")
+	}
+}
+
+func TestStorage_UnknownMethod(t *testing.T) {
+	s := New(memory.New())
+	if err := s.SetFaults([]model.StorageFault{{Method: "DropDatabase", Error: "boom"}}); err == nil {
+		t.Error("expected error for unknown method")
+	}
+}
@@ -0,0 +1,91 @@
+package lock
+
+import (
+	"context"
+	"sync"
+)
+
+// Registry hands out in-process locks by id for storages that have no lock of their own to take per order.
+type Registry struct {
+	mutex    sync.Mutex
+	idToLock map[string]*entry
+}
+
+// entry is dropped from the registry once no one holds or waits for its lock.
+type entry struct {
+	lock    chan struct{}
+	waiters int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		idToLock: make(map[string]*entry),
+	}
+}
+
+// Acquire waits until id is free or ctx is done and returns the function releasing it.
+func (r *Registry) Acquire(ctx context.Context, id string) (func(), error) {
+	entry := r.enter(id)
+	select {
+	case entry.lock <- struct{}{}:
+		return func() {
+			<-entry.lock
+			r.leave(id, entry)
+		}, nil
+	case <-ctx.Done():
+		r.leave(id, entry)
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Registry) enter(id string) *entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	e, ok := r.idToLock[id]
+	if !ok {
+		e = &entry{lock: make(chan struct{}, 1)}
+		r.idToLock[id] = e
+	}
+	e.waiters++
+	return e
+}
+
+func (r *Registry) leave(id string, e *entry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	e.waiters--
+	if e.waiters == 0 {
+		delete(r.idToLock, id)
+	}
+}
+
+// Held tracks locks taken in one transaction so that they are released together when it ends.
+type Held struct {
+	releases map[string]func()
+}
+
+func NewHeld() *Held {
+	return &Held{
+		releases: make(map[string]func()),
+	}
+}
+
+// Acquire takes id from registry unless it is already held.
+func (h *Held) Acquire(ctx context.Context, registry *Registry, id string) error {
+	if _, ok := h.releases[id]; ok {
+		return nil
+	}
+	release, err := registry.Acquire(ctx, id)
+	if err != nil {
+		return err
+	}
+	h.releases[id] = release
+	return nil
+}
+
+func (h *Held) ReleaseAll() {
+	for id, release := range h.releases {
+		release()
+		delete(h.releases, id)
+	}
+}
@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry_DropsReleasedLocks(t *testing.T) {
+	registry := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := registry.Acquire(context.Background(), fmt.Sprintf("order-%d", i%5))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			release()
+		}()
+	}
+	wg.Wait()
+
+	// a waiter giving up leaves nothing behind either
+	release, err := registry.Acquire(context.Background(), "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := registry.Acquire(ctx, "order"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected held lock to time out but got %v", err)
+	}
+	release()
+
+	if len(registry.idToLock) != 0 {
+		t.Errorf("expected no locks after releasing them but got %d", len(registry.idToLock))
+	}
+}
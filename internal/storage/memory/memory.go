@@ -0,0 +1,472 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"order-event-processor/internal/storage/lock"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type deadLetterEvent struct {
+	model.OrderEvent
+	DeadLetteredAt time.Time
+	Reason         string
+}
+
+// Storage keeps orders and order events in memory. Writes made in a transaction are visible to other callers
+// right away and reverted on rollback, per-order locks keep transactions touching the same order apart.
+type Storage struct {
+	mutex             sync.RWMutex
+	eventIdToEvent    map[string]model.OrderEvent
+	orderIdToEventIds map[string][]string
+	orderIdToOrder    map[string]model.Order
+	deadLetters       map[string]deadLetterEvent
+	auditLog          []model.AuditEntry
+	locks             *lock.Registry
+}
+
+func New() *Storage {
+	return &Storage{
+		eventIdToEvent:    make(map[string]model.OrderEvent),
+		orderIdToEventIds: make(map[string][]string),
+		orderIdToOrder:    make(map[string]model.Order),
+		deadLetters:       make(map[string]deadLetterEvent),
+		locks:             lock.NewRegistry(),
+	}
+}
+
+type txKey struct{}
+
+type transaction struct {
+	undo  []func()
+	locks *lock.Held
+}
+
+// RunInTransaction calls run with a context bound to a new transaction, changes made by run are reverted
+// if it returns an error. Locks taken with AcquireLock are released when run returns.
+// Calls nested in run join the outer transaction.
+func (s *Storage) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return run(ctx)
+	}
+
+	tx := &transaction{locks: lock.NewHeld()}
+	defer tx.locks.ReleaseAll()
+
+	err := run(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}
+	return err
+}
+
+// AcquireLock locks id until the transaction of ctx ends. Without a transaction it only waits for id to be free.
+func (s *Storage) AcquireLock(ctx context.Context, id string) error {
+	const op = "storage.memory.AcquireLock"
+	if tx, ok := ctx.Value(txKey{}).(*transaction); ok {
+		if err := tx.locks.Acquire(ctx, s.locks, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	release, err := s.locks.Acquire(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	release()
+	return nil
+}
+
+// modify runs change under the write lock, undo registers how to revert a change if the transaction rolls back.
+func (s *Storage) modify(ctx context.Context, change func(undo func(revert func())) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tx, _ := ctx.Value(txKey{}).(*transaction)
+	return change(func(revert func()) {
+		if tx != nil {
+			tx.undo = append(tx.undo, revert)
+		}
+	})
+}
+
+func (s *Storage) putEvent(event model.OrderEvent, undo func(revert func())) {
+	previous, existed := s.eventIdToEvent[event.EventID]
+	previousIds := slices.Clone(s.orderIdToEventIds[event.OrderID])
+	s.eventIdToEvent[event.EventID] = event
+	if !existed {
+		s.orderIdToEventIds[event.OrderID] = append(s.orderIdToEventIds[event.OrderID], event.EventID)
+	}
+	undo(func() {
+		if existed {
+			s.eventIdToEvent[event.EventID] = previous
+			return
+		}
+		delete(s.eventIdToEvent, event.EventID)
+		s.restoreEventIds(event.OrderID, previousIds)
+	})
+}
+
+func (s *Storage) removeEvent(event model.OrderEvent, undo func(revert func())) {
+	previousIds := slices.Clone(s.orderIdToEventIds[event.OrderID])
+	delete(s.eventIdToEvent, event.EventID)
+	s.restoreEventIds(event.OrderID, slices.DeleteFunc(slices.Clone(previousIds), func(id string) bool {
+		return id == event.EventID
+	}))
+	undo(func() {
+		s.eventIdToEvent[event.EventID] = event
+		s.restoreEventIds(event.OrderID, previousIds)
+	})
+}
+
+func (s *Storage) restoreEventIds(orderId string, eventIds []string) {
+	if len(eventIds) == 0 {
+		delete(s.orderIdToEventIds, orderId)
+	} else {
+		s.orderIdToEventIds[orderId] = eventIds
+	}
+}
+
+func (s *Storage) putOrder(order model.Order, undo func(revert func())) {
+	previous, existed := s.orderIdToOrder[order.OrderID]
+	s.orderIdToOrder[order.OrderID] = order
+	undo(func() {
+		if existed {
+			s.orderIdToOrder[order.OrderID] = previous
+		} else {
+			delete(s.orderIdToOrder, order.OrderID)
+		}
+	})
+}
+
+func (s *Storage) removeOrder(orderId string, undo func(revert func())) {
+	previous, existed := s.orderIdToOrder[orderId]
+	if !existed {
+		return
+	}
+	delete(s.orderIdToOrder, orderId)
+	undo(func() {
+		s.orderIdToOrder[orderId] = previous
+	})
+}
+
+// eventsOf returns events of the order in insertion order, the caller must hold the read lock.
+func (s *Storage) eventsOf(orderId string) []model.OrderEvent {
+	eventIds := s.orderIdToEventIds[orderId]
+	orderEvents := make([]model.OrderEvent, 0, len(eventIds))
+	for _, eventId := range eventIds {
+		orderEvents = append(orderEvents, s.eventIdToEvent[eventId])
+	}
+	return orderEvents
+}
+
+// sortedOrderIds returns ids of orders having events, the caller must hold the read lock.
+func (s *Storage) sortedOrderIds() []string {
+	orderIds := make([]string, 0, len(s.orderIdToEventIds))
+	for orderId := range s.orderIdToEventIds {
+		orderIds = append(orderIds, orderId)
+	}
+	sort.Strings(orderIds)
+	return orderIds
+}
+
+func (s *Storage) filterEvents(keep func(event model.OrderEvent) bool) []model.OrderEvent {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var orderEvents []model.OrderEvent
+	for _, orderId := range s.sortedOrderIds() {
+		for _, event := range s.eventsOf(orderId) {
+			if keep(event) {
+				orderEvents = append(orderEvents, event)
+			}
+		}
+	}
+	return orderEvents
+}
+
+func (s *Storage) SaveOrderEvent(ctx context.Context, orderEvent model.OrderEvent) error {
+	const op = "storage.memory.SaveEvent"
+	return s.modify(ctx, func(undo func(revert func())) error {
+		if _, exists := s.eventIdToEvent[orderEvent.EventID]; exists {
+			return fmt.Errorf("%s: %w", op, storage.EventExists)
+		}
+		orderEvent.InOrder = false
+		orderEvent.AppliedAt = nil
+		if orderEvent.ReceivedAt.IsZero() {
+			orderEvent.ReceivedAt = time.Now().UTC()
+		}
+		s.putEvent(orderEvent, undo)
+		return nil
+	})
+}
+
+func (s *Storage) UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		event, ok := s.eventIdToEvent[eventId]
+		if !ok {
+			return nil
+		}
+		event.IsFinal = true
+		s.putEvent(event, undo)
+		return nil
+	})
+}
+
+func (s *Storage) ExistsOrderEventWithEventId(_ context.Context, eventId string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, exists := s.eventIdToEvent[eventId]
+	return exists, nil
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(_ context.Context, orderId string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return slices.ContainsFunc(s.eventsOf(orderId), func(event model.OrderEvent) bool {
+		return event.IsFinal && event.InOrder
+	}), nil
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdWithStatus(_ context.Context, orderId string, orderStatus model.OrderStatus) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return slices.ContainsFunc(s.eventsOf(orderId), func(event model.OrderEvent) bool {
+		return event.OrderStatus == orderStatus
+	}), nil
+}
+
+func (s *Storage) InsertOrUpdateOrder(ctx context.Context, order model.Order) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		s.putOrder(order, undo)
+		return nil
+	})
+}
+
+func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, orderEvents ...model.OrderEvent) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		for _, orderEvent := range orderEvents {
+			if existing, ok := s.eventIdToEvent[orderEvent.EventID]; ok {
+				existing.InOrder = orderEvent.InOrder
+				existing.IsFinal = orderEvent.IsFinal
+				if existing.AppliedAt == nil {
+					existing.AppliedAt = orderEvent.AppliedAt
+				}
+				s.putEvent(existing, undo)
+				continue
+			}
+			if orderEvent.ReceivedAt.IsZero() {
+				orderEvent.ReceivedAt = time.Now().UTC()
+			}
+			s.putEvent(orderEvent, undo)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetAllEventsByOrderId(_ context.Context, orderId string) ([]model.OrderEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	orderEvents := s.eventsOf(orderId)
+	if len(orderEvents) == 0 {
+		return nil, nil
+	}
+	return orderEvents, nil
+}
+
+func (s *Storage) UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, orderEvents ...model.OrderEvent) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		for _, orderEvent := range orderEvents {
+			existing, ok := s.eventIdToEvent[orderEvent.EventID]
+			if !ok {
+				continue
+			}
+			existing.InOrder = orderEvent.InOrder
+			existing.IsFinal = orderEvent.IsFinal
+			s.putEvent(existing, undo)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetAllInOrderEvents(_ context.Context) ([]model.OrderEvent, error) {
+	return s.filterEvents(func(event model.OrderEvent) bool {
+		return event.InOrder
+	}), nil
+}
+
+func (s *Storage) GetAllOrderIds(_ context.Context) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.sortedOrderIds(), nil
+}
+
+func (s *Storage) GetEventsOfOrdersWithOutOfOrderEvents(_ context.Context) ([]model.OrderEvent, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var orderEvents []model.OrderEvent
+	for _, orderId := range s.sortedOrderIds() {
+		events := s.eventsOf(orderId)
+		hasOutOfOrder := slices.ContainsFunc(events, func(event model.OrderEvent) bool {
+			return !event.InOrder
+		})
+		if hasOutOfOrder {
+			orderEvents = append(orderEvents, events...)
+		}
+	}
+	return orderEvents, nil
+}
+
+func (s *Storage) DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (int64, error) {
+	var count int64
+	err := s.modify(ctx, func(undo func(revert func())) error {
+		now := time.Now().UTC()
+		for _, eventId := range eventIds {
+			event, ok := s.eventIdToEvent[eventId]
+			if !ok || event.InOrder {
+				continue
+			}
+			s.removeEvent(event, undo)
+			// an event delivered again after it was dead-lettered replaces its earlier dead letter
+			previous, existed := s.deadLetters[eventId]
+			s.deadLetters[eventId] = deadLetterEvent{OrderEvent: event, DeadLetteredAt: now, Reason: reason}
+			undo(func() {
+				if existed {
+					s.deadLetters[eventId] = previous
+				} else {
+					delete(s.deadLetters, eventId)
+				}
+			})
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (s *Storage) GetEventTimingsSince(_ context.Context, since time.Time) ([]model.EventTiming, error) {
+	var timings []model.EventTiming
+	for _, event := range s.filterEvents(func(event model.OrderEvent) bool {
+		// events created by an operator were never delivered by the payment system
+		return !event.ReceivedAt.Before(since) && event.OperatorID == ""
+	}) {
+		timings = append(timings, model.EventTiming{UpdatedAt: event.UpdatedAt, ReceivedAt: event.ReceivedAt, AppliedAt: event.AppliedAt})
+	}
+	return timings, nil
+}
+
+func (s *Storage) GetAllOrders(_ context.Context) ([]model.Order, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var orders []model.Order
+	for _, order := range s.orderIdToOrder {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	return orders, nil
+}
+
+func (s *Storage) GetOrder(_ context.Context, orderId string) (model.Order, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	order, ok := s.orderIdToOrder[orderId]
+	if !ok {
+		return model.Order{}, storage.OrderNotFound
+	}
+	return order, nil
+}
+
+func (s *Storage) GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (model.OrderState, error) {
+	const op = "storage.memory.GetOrderAsOf"
+	if timeline != model.TimelineUpdatedAt && timeline != model.TimelineReceivedAt {
+		return model.OrderState{}, fmt.Errorf("%s: unknown timeline %s", op, timeline)
+	}
+
+	orderEvents, err := s.GetAllEventsByOrderId(ctx, orderId)
+	if err != nil {
+		return model.OrderState{}, err
+	}
+
+	state, ok := ordering.StateAsOf(orderEvents, asOf.UTC(), timeline)
+	if !ok {
+		return model.OrderState{}, storage.OrderNotFound
+	}
+	return state, nil
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, orderId string) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		s.removeOrder(orderId, undo)
+		return nil
+	})
+}
+
+func (s *Storage) DeleteOrderEvent(ctx context.Context, eventId string) error {
+	const op = "storage.memory.DeleteOrderEvent"
+	return s.modify(ctx, func(undo func(revert func())) error {
+		event, ok := s.eventIdToEvent[eventId]
+		if !ok {
+			return fmt.Errorf("%s: %w", op, storage.EventNotFound)
+		}
+		s.removeEvent(event, undo)
+		return nil
+	})
+}
+
+func (s *Storage) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		previous := s.auditLog
+		entry.ID = int64(len(s.auditLog) + 1)
+		s.auditLog = append(slices.Clip(s.auditLog), entry)
+		undo(func() {
+			s.auditLog = previous
+		})
+		return nil
+	})
+}
+
+func (s *Storage) GetAuditEntries(_ context.Context, orderId string) ([]model.AuditEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var entries []model.AuditEntry
+	for _, entry := range s.auditLog {
+		if entry.OrderID == orderId {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *Storage) DeleteAllFromOrderEvents(ctx context.Context) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		for _, event := range s.eventIdToEvent {
+			s.removeEvent(event, undo)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) DeleteAllFromOrders(ctx context.Context) error {
+	return s.modify(ctx, func(undo func(revert func())) error {
+		for orderId := range s.orderIdToOrder {
+			s.removeOrder(orderId, undo)
+		}
+		return nil
+	})
+}
+
+// Ping always succeeds, there is no database to reach.
+func (s *Storage) Ping(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage"
+	"testing"
+	"time"
+)
+
+func orderEvent(eventId string, status model.OrderStatus) model.OrderEvent {
+	return model.OrderEvent{
+		EventID: eventId,
+		Order:   model.Order{OrderID: "order", UserID: "user", OrderStatus: status},
+	}
+}
+
+func TestStorage_RunInTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, orderEvent("1", model.StatusCoolOrderCreated)); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		inOrder := orderEvent("1", model.StatusCoolOrderCreated)
+		inOrder.InOrder = true
+		if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, inOrder, orderEvent("2", model.StatusSbuVerificationPending)); err != nil {
+			return err
+		}
+		if err := s.InsertOrUpdateOrder(ctx, inOrder.Order); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected %v but got %v", failure, err)
+	}
+
+	events, _ := s.GetAllEventsByOrderId(ctx, "order")
+	if len(events) != 1 || events[0].InOrder {
+		t.Errorf("expected only the initial event not in order but got %+v", events)
+	}
+	if _, err := s.GetOrder(ctx, "order"); !errors.Is(err, storage.OrderNotFound) {
+		t.Errorf("expected order to be rolled back but got %v", err)
+	}
+}
+
+func TestStorage_DeadLetterOrderEventsAgain(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	deadLetter := func(ctx context.Context, reason string) error {
+		if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, orderEvent("1", model.StatusChinazes)); err != nil {
+			return err
+		}
+		_, err := s.DeadLetterOrderEvents(ctx, reason, "1")
+		return err
+	}
+	if err := deadLetter(ctx, "expired"); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := deadLetter(ctx, "expired again"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected %v but got %v", failure, err)
+	}
+	if deadLetter := s.deadLetters["1"]; deadLetter.Reason != "expired" {
+		t.Errorf("expected the earlier dead letter to be kept on rollback but got %+v", deadLetter)
+	}
+
+	if err := deadLetter(ctx, "expired again"); err != nil {
+		t.Fatal(err)
+	}
+	if deadLetter := s.deadLetters["1"]; len(s.deadLetters) != 1 || deadLetter.Reason != "expired again" {
+		t.Errorf("expected a single dead letter with the latest reason but got %+v", s.deadLetters)
+	}
+}
+
+func TestStorage_GetEventTimingsSinceSkipsOperatorEvents(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	received := orderEvent("1", model.StatusCoolOrderCreated)
+	forced := orderEvent("2", model.StatusConfirmedByMayor)
+	forced.OperatorID = "support"
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, received, forced); err != nil {
+		t.Fatal(err)
+	}
+
+	timings, err := s.GetEventTimingsSince(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timings) != 1 {
+		t.Errorf("expected only the received event to be timed but got %+v", timings)
+	}
+}
+
+func TestStorage_SaveOrderEventRejectsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	if err := s.SaveOrderEvent(ctx, orderEvent("1", model.StatusCoolOrderCreated)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveOrderEvent(ctx, orderEvent("1", model.StatusCoolOrderCreated)); !errors.Is(err, storage.EventExists) {
+		t.Errorf("expected %v but got %v", storage.EventExists, err)
+	}
+}
+
+func TestStorage_AcquireLockIsHeldUntilTransactionEnds(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go s.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.AcquireLock(ctx, "order"); err != nil {
+			return err
+		}
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := s.RunInTransaction(timeoutCtx, func(ctx context.Context) error {
+		return s.AcquireLock(ctx, "order")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected lock to be held but got %v", err)
+	}
+
+	close(release)
+	err = s.RunInTransaction(ctx, func(ctx context.Context) error {
+		return s.AcquireLock(ctx, "order")
+	})
+	if err != nil {
+		t.Errorf("expected lock to be released but got %v", err)
+	}
+}
@@ -2,11 +2,16 @@ package postgresql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"hash/fnv"
 	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"time"
 )
 
 type Storage struct {
@@ -19,26 +24,58 @@ func New(pool *pgxpool.Pool) *Storage {
 	}
 }
 
-func (s *Storage) RunInTransaction(run func()) error {
-	tx, err := s.pool.Begin(context.Background())
+const uniqueViolation = "23505"
+
+type txKey struct{}
+
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// querier returns the transaction started by RunInTransaction if ctx carries one, otherwise the pool.
+func (s *Storage) querier(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return s.pool
+}
+
+// RunInTransaction calls run with a context bound to a new transaction, which is committed if run succeeds
+// and rolled back otherwise. Calls nested in run join the outer transaction.
+func (s *Storage) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	const op = "storage.postgresql.RunInTransaction"
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return run(ctx)
+	}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("%s: begin: %w", op, err)
+	}
+	if err := run(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(context.WithoutCancel(ctx)); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("%s: rollback: %w", op, rollbackErr))
+		}
 		return err
 	}
-	run()
-	if err := tx.Commit(context.Background()); err != nil {
-		return tx.Rollback(context.Background())
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
 	}
 	return nil
 }
 
-func (s *Storage) AcquireLock(id string) error {
-	const op = "storage.postgresql.SaveEvent"
+// AcquireLock takes a transaction level advisory lock on id, it is held until the transaction of ctx ends.
+func (s *Storage) AcquireLock(ctx context.Context, id string) error {
+	const op = "storage.postgresql.AcquireLock"
 	h := fnv.New32a()
 	h.Write([]byte(id))
 	sum32 := h.Sum32()
 
 	query := `SELECT pg_advisory_xact_lock($1)`
-	_, err := s.pool.Exec(context.Background(), query, sum32)
+	_, err := s.querier(ctx).Exec(ctx, query, sum32)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -46,23 +83,26 @@ func (s *Storage) AcquireLock(id string) error {
 	return nil
 }
 
-func (s *Storage) SaveOrderEvent(orderEvent model.OrderEvent) error {
+func (s *Storage) SaveOrderEvent(ctx context.Context, orderEvent model.OrderEvent) error {
 	const op = "storage.postgresql.SaveEvent"
 
 	query := `INSERT INTO order_events (event_id, order_id, user_id, order_status, is_final, updated_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := s.pool.Exec(context.Background(), query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt, orderEvent.CreatedAt)
-	if err != nil {
+	_, err := s.querier(ctx).Exec(ctx, query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt, orderEvent.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%s: %w", op, storage.EventExists)
+	} else if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) UpdateOrderEventFinalStatus(eventId string) error {
+func (s *Storage) UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error {
 	const op = "storage.postgresql.UpdateOrderEventFinalStatus"
 
 	query := `UPDATE order_events SET is_final = TRUE WHERE event_id = $1;`
-	_, err := s.pool.Exec(context.Background(), query, eventId)
+	_, err := s.querier(ctx).Exec(ctx, query, eventId)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -70,10 +110,10 @@ func (s *Storage) UpdateOrderEventFinalStatus(eventId string) error {
 	return nil
 }
 
-func (s *Storage) ExistsOrderEventWithEventId(eventId string) (bool, error) {
+func (s *Storage) ExistsOrderEventWithEventId(ctx context.Context, eventId string) (bool, error) {
 	const op = "storage.postgresql.ExistsOrderEventWithEventId"
 	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE event_id = $1)`
-	row := s.pool.QueryRow(context.Background(), query, eventId)
+	row := s.querier(ctx).QueryRow(ctx, query, eventId)
 
 	var exists bool
 	err := row.Scan(&exists)
@@ -84,10 +124,10 @@ func (s *Storage) ExistsOrderEventWithEventId(eventId string) (bool, error) {
 	return exists, nil
 }
 
-func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(orderId string) (bool, error) {
+func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(ctx context.Context, orderId string) (bool, error) {
 	const op = "storage.postgresql.ExistsOrderEventForOrderIdWithIsFinalStatus"
 	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE order_id = $1 AND is_final = TRUE AND is_in_order = TRUE)`
-	row := s.pool.QueryRow(context.Background(), query, orderId)
+	row := s.querier(ctx).QueryRow(ctx, query, orderId)
 
 	var exists bool
 	err := row.Scan(&exists)
@@ -98,10 +138,10 @@ func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(orderId string) (boo
 	return exists, nil
 }
 
-func (s *Storage) ExistsOrderEventForOrderIdWithStatus(orderId string, orderStatus model.OrderStatus) (bool, error) {
+func (s *Storage) ExistsOrderEventForOrderIdWithStatus(ctx context.Context, orderId string, orderStatus model.OrderStatus) (bool, error) {
 	const op = "storage.postgresql.ExistsOrderEventForOrderIdWithStatus"
 	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE order_id = $1 AND order_status = $2)`
-	row := s.pool.QueryRow(context.Background(), query, orderId, orderStatus)
+	row := s.querier(ctx).QueryRow(ctx, query, orderId, orderStatus)
 
 	var exists bool
 	err := row.Scan(&exists)
@@ -112,12 +152,12 @@ func (s *Storage) ExistsOrderEventForOrderIdWithStatus(orderId string, orderStat
 	return exists, nil
 }
 
-func (s *Storage) InsertOrUpdateOrder(order model.Order) error {
+func (s *Storage) InsertOrUpdateOrder(ctx context.Context, order model.Order) error {
 	const op = "storage.postgresql.InsertOrUpdateOrder"
 
 	query := `INSERT INTO orders (order_id, user_id, order_status, is_final, updated_at, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (order_id) 
 				  DO UPDATE SET order_status = EXCLUDED.order_status, is_final = EXCLUDED.is_final, updated_at = EXCLUDED.updated_at, created_at = EXCLUDED.created_at`
-	_, err := s.pool.Exec(context.Background(), query, order.OrderID, order.UserID, order.OrderStatus, order.IsFinal, order.UpdatedAt, order.CreatedAt)
+	_, err := s.querier(ctx).Exec(ctx, query, order.OrderID, order.UserID, order.OrderStatus, order.IsFinal, order.UpdatedAt, order.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -125,20 +165,20 @@ func (s *Storage) InsertOrUpdateOrder(order model.Order) error {
 	return nil
 }
 
-func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(orderEvents ...model.OrderEvent) error {
+func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, orderEvents ...model.OrderEvent) error {
 	const op = "storage.postgresql.InsertOrderEventsOrUpdateIsInOrder"
 
 	batch := &pgx.Batch{}
 
 	for _, orderEvent := range orderEvents {
-		query := `INSERT INTO order_events (event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order) 
-				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+		query := `INSERT INTO order_events (event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, operator_id, operator_reason) 
+				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, '')) 
 				  ON CONFLICT (event_id) 
-				  DO UPDATE SET is_in_order = EXCLUDED.is_in_order`
-		batch.Queue(query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt, orderEvent.CreatedAt, orderEvent.InOrder)
+				  DO UPDATE SET is_in_order = EXCLUDED.is_in_order, is_final = EXCLUDED.is_final, applied_at = COALESCE(order_events.applied_at, EXCLUDED.applied_at)`
+		batch.Queue(query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt, orderEvent.CreatedAt, orderEvent.InOrder, orderEvent.ReceivedAt, orderEvent.AppliedAt, orderEvent.OperatorID, orderEvent.OperatorReason)
 	}
 
-	batchResults := s.pool.SendBatch(context.Background(), batch)
+	batchResults := s.querier(ctx).SendBatch(ctx, batch)
 	defer batchResults.Close()
 
 	for i := 0; i < len(orderEvents); i++ {
@@ -151,11 +191,60 @@ func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(orderEvents ...model.OrderE
 	return nil
 }
 
-func (s *Storage) GetAllEventsByOrderId(orderId string) ([]model.OrderEvent, error) {
+func (s *Storage) GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error) {
 	const op = "storage.postgresql.GetAllOrders"
-	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order FROM order_events WHERE order_id = $1`
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events WHERE order_id = $1`
+
+	rows, err := s.querier(ctx).Query(ctx, query, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderEvents []model.OrderEvent
+	for rows.Next() {
+		var orderEvent model.OrderEvent
+		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder, &orderEvent.ReceivedAt, &orderEvent.AppliedAt, &orderEvent.OperatorID, &orderEvent.OperatorReason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderEvents = append(orderEvents, orderEvent)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orderEvents, nil
+}
+
+func (s *Storage) UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, orderEvents ...model.OrderEvent) error {
+	const op = "storage.postgresql.UpdateOrderEventsIsInOrderAndIsFinal"
+
+	batch := &pgx.Batch{}
+	for _, orderEvent := range orderEvents {
+		query := `UPDATE order_events SET is_in_order = $2, is_final = $3 WHERE event_id = $1`
+		batch.Queue(query, orderEvent.EventID, orderEvent.InOrder, orderEvent.IsFinal)
+	}
+
+	batchResults := s.querier(ctx).SendBatch(ctx, batch)
+	defer batchResults.Close()
+
+	for i := 0; i < len(orderEvents); i++ {
+		_, err := batchResults.Exec()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetAllInOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	const op = "storage.postgresql.GetAllInOrderEvents"
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events WHERE is_in_order = TRUE`
 
-	rows, err := s.pool.Query(context.Background(), query, orderId)
+	rows, err := s.querier(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("%s: query: %w", op, err)
 	}
@@ -164,7 +253,7 @@ func (s *Storage) GetAllEventsByOrderId(orderId string) ([]model.OrderEvent, err
 	var orderEvents []model.OrderEvent
 	for rows.Next() {
 		var orderEvent model.OrderEvent
-		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder)
+		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder, &orderEvent.ReceivedAt, &orderEvent.AppliedAt, &orderEvent.OperatorID, &orderEvent.OperatorReason)
 		if err != nil {
 			return nil, fmt.Errorf("%s: scan row: %w", op, err)
 		}
@@ -178,11 +267,116 @@ func (s *Storage) GetAllEventsByOrderId(orderId string) ([]model.OrderEvent, err
 	return orderEvents, nil
 }
 
-func (s *Storage) GetAllOrders() ([]model.Order, error) {
+func (s *Storage) GetAllOrderIds(ctx context.Context) ([]string, error) {
+	const op = "storage.postgresql.GetAllOrderIds"
+	query := `SELECT DISTINCT order_id FROM order_events ORDER BY order_id`
+
+	rows, err := s.querier(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderIds []string
+	for rows.Next() {
+		var orderId string
+		if err := rows.Scan(&orderId); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderIds = append(orderIds, orderId)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orderIds, nil
+}
+
+func (s *Storage) GetEventsOfOrdersWithOutOfOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	const op = "storage.postgresql.GetEventsOfOrdersWithOutOfOrderEvents"
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events 
+				WHERE order_id IN (SELECT order_id FROM order_events WHERE is_in_order = FALSE)`
+
+	rows, err := s.querier(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderEvents []model.OrderEvent
+	for rows.Next() {
+		var orderEvent model.OrderEvent
+		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder, &orderEvent.ReceivedAt, &orderEvent.AppliedAt, &orderEvent.OperatorID, &orderEvent.OperatorReason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderEvents = append(orderEvents, orderEvent)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orderEvents, nil
+}
+
+// DeadLetterOrderEvents moves out of order events among eventIds to dead_letter_order_events, in order events are kept.
+// An event delivered again after it was dead-lettered replaces its earlier dead letter.
+func (s *Storage) DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (int64, error) {
+	const op = "storage.postgresql.DeadLetterOrderEvents"
+
+	query := `WITH moved AS (
+				DELETE FROM order_events WHERE event_id = ANY($1) AND is_in_order = FALSE 
+				RETURNING event_id, order_id, user_id, order_status, updated_at, created_at, received_at
+			  )
+			  INSERT INTO dead_letter_order_events (event_id, order_id, user_id, order_status, updated_at, created_at, received_at, reason) 
+			  SELECT event_id, order_id, user_id, order_status, updated_at, created_at, received_at, $2 FROM moved
+			  ON CONFLICT (event_id) DO UPDATE SET order_id = EXCLUDED.order_id, user_id = EXCLUDED.user_id,
+			  order_status = EXCLUDED.order_status, updated_at = EXCLUDED.updated_at, created_at = EXCLUDED.created_at,
+			  received_at = EXCLUDED.received_at, reason = EXCLUDED.reason, dead_lettered_at = EXCLUDED.dead_lettered_at`
+	tag, err := s.querier(ctx).Exec(ctx, query, eventIds, reason)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetEventTimingsSince returns timings of events received from the payment system, events created by an operator
+// were never delivered and are left out.
+func (s *Storage) GetEventTimingsSince(ctx context.Context, since time.Time) ([]model.EventTiming, error) {
+	const op = "storage.postgresql.GetEventTimingsSince"
+	query := `SELECT updated_at, received_at, applied_at FROM order_events WHERE received_at >= $1 AND COALESCE(operator_id, '') = ''`
+
+	rows, err := s.querier(ctx).Query(ctx, query, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var timings []model.EventTiming
+	for rows.Next() {
+		var timing model.EventTiming
+		err := rows.Scan(&timing.UpdatedAt, &timing.ReceivedAt, &timing.AppliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		timings = append(timings, timing)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return timings, nil
+}
+
+func (s *Storage) GetAllOrders(ctx context.Context) ([]model.Order, error) {
 	const op = "storage.postgresql.GetAllOrders"
 	query := `SELECT order_id, user_id, order_status, is_final, updated_at, created_at FROM orders`
 
-	rows, err := s.pool.Query(context.Background(), query)
+	rows, err := s.querier(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("%s: query: %w", op, err)
 	}
@@ -191,7 +385,7 @@ func (s *Storage) GetAllOrders() ([]model.Order, error) {
 	var orders []model.Order
 	for rows.Next() {
 		var order model.Order
-		err := rows.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.IsFinal, &order.CreatedAt, &order.UpdatedAt)
+		err := rows.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.IsFinal, &order.UpdatedAt, &order.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("%s: scan row: %w", op, err)
 		}
@@ -205,11 +399,136 @@ func (s *Storage) GetAllOrders() ([]model.Order, error) {
 	return orders, nil
 }
 
-func (s *Storage) DeleteAllFromOrderEvents() error {
+func (s *Storage) GetOrder(ctx context.Context, orderId string) (model.Order, error) {
+	const op = "storage.postgresql.GetOrder"
+	query := `SELECT order_id, user_id, order_status, is_final, updated_at, created_at FROM orders WHERE order_id = $1`
+	row := s.querier(ctx).QueryRow(ctx, query, orderId)
+
+	var order model.Order
+	err := row.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.IsFinal, &order.UpdatedAt, &order.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Order{}, storage.OrderNotFound
+	} else if err != nil {
+		return model.Order{}, fmt.Errorf("%s: scan row: %w", op, err)
+	}
+
+	return order, nil
+}
+
+var timelineToColumn = map[model.Timeline]string{
+	model.TimelineUpdatedAt:  "updated_at",
+	model.TimelineReceivedAt: "received_at",
+}
+
+func (s *Storage) GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (model.OrderState, error) {
+	const op = "storage.postgresql.GetOrderAsOf"
+	column, ok := timelineToColumn[timeline]
+	if !ok {
+		return model.OrderState{}, fmt.Errorf("%s: unknown timeline %s", op, timeline)
+	}
+	query := fmt.Sprintf(`SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events 
+				WHERE order_id = $1 AND %s <= $2`, column)
+
+	rows, err := s.querier(ctx).Query(ctx, query, orderId, asOf.UTC())
+	if err != nil {
+		return model.OrderState{}, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderEvents []model.OrderEvent
+	for rows.Next() {
+		var orderEvent model.OrderEvent
+		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder, &orderEvent.ReceivedAt, &orderEvent.AppliedAt, &orderEvent.OperatorID, &orderEvent.OperatorReason)
+		if err != nil {
+			return model.OrderState{}, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderEvents = append(orderEvents, orderEvent)
+	}
+
+	if rows.Err() != nil {
+		return model.OrderState{}, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	state, ok := ordering.StateAsOf(orderEvents, asOf.UTC(), timeline)
+	if !ok {
+		return model.OrderState{}, storage.OrderNotFound
+	}
+
+	return state, nil
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, orderId string) error {
+	const op = "storage.postgresql.DeleteOrder"
+
+	query := `DELETE FROM orders WHERE order_id = $1`
+	_, err := s.querier(ctx).Exec(ctx, query, orderId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteOrderEvent(ctx context.Context, eventId string) error {
+	const op = "storage.postgresql.DeleteOrderEvent"
+
+	query := `DELETE FROM order_events WHERE event_id = $1`
+	tag, err := s.querier(ctx).Exec(ctx, query, eventId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	} else if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storage.EventNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+	const op = "storage.postgresql.InsertAuditEntry"
+
+	query := `INSERT INTO audit_log (order_id, event_id, action, operator_id, reason, details, created_at) 
+			  VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6, $7)`
+	_, err := s.querier(ctx).Exec(ctx, query, entry.OrderID, entry.EventID, entry.Action, entry.OperatorID, entry.Reason, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetAuditEntries(ctx context.Context, orderId string) ([]model.AuditEntry, error) {
+	const op = "storage.postgresql.GetAuditEntries"
+
+	query := `SELECT id, order_id, COALESCE(event_id::text, ''), action, operator_id, reason, details, created_at FROM audit_log 
+				WHERE order_id = $1 ORDER BY id`
+	rows, err := s.querier(ctx).Query(ctx, query, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var entry model.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.OrderID, &entry.EventID, &entry.Action, &entry.OperatorID, &entry.Reason, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return entries, nil
+}
+
+func (s *Storage) DeleteAllFromOrderEvents(ctx context.Context) error {
 	const op = "storage.postgresql.DeleteAllFromOrderEvents"
 
 	query := `DELETE FROM order_events;`
-	_, err := s.pool.Exec(context.Background(), query)
+	_, err := s.querier(ctx).Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -217,14 +536,30 @@ func (s *Storage) DeleteAllFromOrderEvents() error {
 	return nil
 }
 
-func (s *Storage) DeleteAllFromOrders() error {
+func (s *Storage) DeleteAllFromOrders(ctx context.Context) error {
 	const op = "storage.postgresql.DeleteAllFromOrders"
 
 	query := `DELETE FROM orders;`
-	_, err := s.pool.Exec(context.Background(), query)
+	_, err := s.querier(ctx).Exec(ctx, query)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *Storage) PoolStats() model.PoolStats {
+	stat := s.pool.Stat()
+	return model.PoolStats{
+		MaxConns:       stat.MaxConns(),
+		TotalConns:     stat.TotalConns(),
+		AcquiredConns:  stat.AcquiredConns(),
+		IdleConns:      stat.IdleConns(),
+		WaitCount:      stat.EmptyAcquireCount(),
+		WaitDurationMs: stat.AcquireDuration().Milliseconds(),
+	}
+}
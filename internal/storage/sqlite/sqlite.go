@@ -0,0 +1,554 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/ordering"
+	"order-event-processor/internal/storage"
+	"order-event-processor/internal/storage/lock"
+	"strings"
+	"time"
+)
+
+// Storage keeps orders and order events in a SQLite database. SQLite has a single writer, so transactions begin
+// immediate and hold the database write lock until they end, per-order locks are kept in process.
+type Storage struct {
+	db    *sql.DB
+	locks *lock.Registry
+}
+
+func New(db *sql.DB) *Storage {
+	return &Storage{
+		db:    db,
+		locks: lock.NewRegistry(),
+	}
+}
+
+// Open opens the database file at path with the pragmas Storage relies on.
+func Open(path string) (*sql.DB, error) {
+	const op = "storage.sqlite.Open"
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return db, nil
+}
+
+type txKey struct{}
+
+type transaction struct {
+	tx    *sql.Tx
+	locks *lock.Held
+}
+
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// querier returns the transaction started by RunInTransaction if ctx carries one, otherwise the database.
+func (s *Storage) querier(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return tx.tx
+	}
+	return s.db
+}
+
+// RunInTransaction calls run with a context bound to a new transaction, which is committed if run succeeds
+// and rolled back otherwise. Locks taken with AcquireLock are released when the transaction ends.
+// Calls nested in run join the outer transaction.
+func (s *Storage) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) error {
+	const op = "storage.sqlite.RunInTransaction"
+	if _, ok := ctx.Value(txKey{}).(*transaction); ok {
+		return run(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: begin: %w", op, err)
+	}
+	locks := lock.NewHeld()
+	defer locks.ReleaseAll()
+
+	if err := run(context.WithValue(ctx, txKey{}, &transaction{tx: tx, locks: locks})); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("%s: rollback: %w", op, rollbackErr))
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: commit: %w", op, err)
+	}
+	return nil
+}
+
+// AcquireLock locks id until the transaction of ctx ends. Without a transaction it only waits for id to be free.
+func (s *Storage) AcquireLock(ctx context.Context, id string) error {
+	const op = "storage.sqlite.AcquireLock"
+	if tx, ok := ctx.Value(txKey{}).(*transaction); ok {
+		if err := tx.locks.Acquire(ctx, s.locks, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	release, err := s.locks.Acquire(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	release()
+	return nil
+}
+
+func (s *Storage) SaveOrderEvent(ctx context.Context, orderEvent model.OrderEvent) error {
+	const op = "storage.sqlite.SaveEvent"
+
+	query := `INSERT INTO order_events (event_id, order_id, user_id, order_status, is_final, updated_at, created_at, received_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.querier(ctx).ExecContext(ctx, query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt.UTC(), orderEvent.CreatedAt.UTC(), receivedAt(orderEvent))
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return fmt.Errorf("%s: %w", op, storage.EventExists)
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateOrderEventFinalStatus(ctx context.Context, eventId string) error {
+	const op = "storage.sqlite.UpdateOrderEventFinalStatus"
+
+	query := `UPDATE order_events SET is_final = TRUE WHERE event_id = ?`
+	_, err := s.querier(ctx).ExecContext(ctx, query, eventId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ExistsOrderEventWithEventId(ctx context.Context, eventId string) (bool, error) {
+	const op = "storage.sqlite.ExistsOrderEventWithEventId"
+	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE event_id = ?)`
+	return s.exists(ctx, op, query, eventId)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(ctx context.Context, orderId string) (bool, error) {
+	const op = "storage.sqlite.ExistsOrderEventForOrderIdFinalAndInOrder"
+	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE order_id = ? AND is_final = TRUE AND is_in_order = TRUE)`
+	return s.exists(ctx, op, query, orderId)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdWithStatus(ctx context.Context, orderId string, orderStatus model.OrderStatus) (bool, error) {
+	const op = "storage.sqlite.ExistsOrderEventForOrderIdWithStatus"
+	query := `SELECT EXISTS(SELECT 1 FROM order_events WHERE order_id = ? AND order_status = ?)`
+	return s.exists(ctx, op, query, orderId, orderStatus)
+}
+
+func (s *Storage) exists(ctx context.Context, op string, query string, args ...any) (bool, error) {
+	var exists bool
+	err := s.querier(ctx).QueryRowContext(ctx, query, args...).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("%s: scan row: %w", op, err)
+	}
+
+	return exists, nil
+}
+
+func (s *Storage) InsertOrUpdateOrder(ctx context.Context, order model.Order) error {
+	const op = "storage.sqlite.InsertOrUpdateOrder"
+
+	query := `INSERT INTO orders (order_id, user_id, order_status, is_final, updated_at, created_at) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (order_id)
+				  DO UPDATE SET order_status = excluded.order_status, is_final = excluded.is_final, updated_at = excluded.updated_at, created_at = excluded.created_at`
+	_, err := s.querier(ctx).ExecContext(ctx, query, order.OrderID, order.UserID, order.OrderStatus, order.IsFinal, order.UpdatedAt.UTC(), order.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, orderEvents ...model.OrderEvent) error {
+	const op = "storage.sqlite.InsertOrderEventsOrUpdateIsInOrder"
+
+	query := `INSERT INTO order_events (event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, operator_id, operator_reason)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''))
+			  ON CONFLICT (event_id)
+			  DO UPDATE SET is_in_order = excluded.is_in_order, is_final = excluded.is_final, applied_at = COALESCE(order_events.applied_at, excluded.applied_at)`
+	return s.RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, orderEvent := range orderEvents {
+			_, err := s.querier(ctx).ExecContext(ctx, query, orderEvent.EventID, orderEvent.OrderID, orderEvent.UserID, orderEvent.OrderStatus, orderEvent.IsFinal, orderEvent.UpdatedAt.UTC(), orderEvent.CreatedAt.UTC(), orderEvent.InOrder, receivedAt(orderEvent), utc(orderEvent.AppliedAt), orderEvent.OperatorID, orderEvent.OperatorReason)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetAllEventsByOrderId(ctx context.Context, orderId string) ([]model.OrderEvent, error) {
+	const op = "storage.sqlite.GetAllEventsByOrderId"
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events WHERE order_id = ? ORDER BY rowid`
+	return s.queryOrderEvents(ctx, op, query, orderId)
+}
+
+func (s *Storage) UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, orderEvents ...model.OrderEvent) error {
+	const op = "storage.sqlite.UpdateOrderEventsIsInOrderAndIsFinal"
+
+	query := `UPDATE order_events SET is_in_order = ?, is_final = ? WHERE event_id = ?`
+	return s.RunInTransaction(ctx, func(ctx context.Context) error {
+		for _, orderEvent := range orderEvents {
+			_, err := s.querier(ctx).ExecContext(ctx, query, orderEvent.InOrder, orderEvent.IsFinal, orderEvent.EventID)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetAllInOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	const op = "storage.sqlite.GetAllInOrderEvents"
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events WHERE is_in_order = TRUE`
+	return s.queryOrderEvents(ctx, op, query)
+}
+
+func (s *Storage) GetAllOrderIds(ctx context.Context) ([]string, error) {
+	const op = "storage.sqlite.GetAllOrderIds"
+	query := `SELECT DISTINCT order_id FROM order_events ORDER BY order_id`
+
+	rows, err := s.querier(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderIds []string
+	for rows.Next() {
+		var orderId string
+		if err := rows.Scan(&orderId); err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderIds = append(orderIds, orderId)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orderIds, nil
+}
+
+func (s *Storage) GetEventsOfOrdersWithOutOfOrderEvents(ctx context.Context) ([]model.OrderEvent, error) {
+	const op = "storage.sqlite.GetEventsOfOrdersWithOutOfOrderEvents"
+	query := `SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events
+				WHERE order_id IN (SELECT order_id FROM order_events WHERE is_in_order = FALSE)`
+	return s.queryOrderEvents(ctx, op, query)
+}
+
+// DeadLetterOrderEvents moves out of order events among eventIds to dead_letter_order_events, in order events are kept.
+// An event delivered again after it was dead-lettered replaces its earlier dead letter.
+func (s *Storage) DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (int64, error) {
+	const op = "storage.sqlite.DeadLetterOrderEvents"
+	if len(eventIds) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(eventIds)), ", ")
+	args := make([]any, 0, len(eventIds)+2)
+	args = append(args, reason, time.Now().UTC())
+	for _, eventId := range eventIds {
+		args = append(args, eventId)
+	}
+
+	var moved int64
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		query := `INSERT INTO dead_letter_order_events (event_id, order_id, user_id, order_status, updated_at, created_at, received_at, reason, dead_lettered_at)
+				  SELECT event_id, order_id, user_id, order_status, updated_at, created_at, received_at, ?, ? FROM order_events
+				  WHERE is_in_order = FALSE AND event_id IN (` + placeholders + `)
+				  ON CONFLICT (event_id) DO UPDATE SET order_id = excluded.order_id, user_id = excluded.user_id,
+				  order_status = excluded.order_status, updated_at = excluded.updated_at, created_at = excluded.created_at,
+				  received_at = excluded.received_at, reason = excluded.reason, dead_lettered_at = excluded.dead_lettered_at`
+		if _, err := s.querier(ctx).ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("%s: insert: %w", op, err)
+		}
+
+		query = `DELETE FROM order_events WHERE is_in_order = FALSE AND event_id IN (` + placeholders + `)`
+		result, err := s.querier(ctx).ExecContext(ctx, query, args[2:]...)
+		if err != nil {
+			return fmt.Errorf("%s: delete: %w", op, err)
+		}
+		moved, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: rows affected: %w", op, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// GetEventTimingsSince returns timings of events received from the payment system, events created by an operator
+// were never delivered and are left out.
+func (s *Storage) GetEventTimingsSince(ctx context.Context, since time.Time) ([]model.EventTiming, error) {
+	const op = "storage.sqlite.GetEventTimingsSince"
+	query := `SELECT updated_at, received_at, applied_at FROM order_events WHERE received_at >= ? AND COALESCE(operator_id, '') = ''`
+
+	rows, err := s.querier(ctx).QueryContext(ctx, query, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var timings []model.EventTiming
+	for rows.Next() {
+		var timing model.EventTiming
+		err := rows.Scan(&timing.UpdatedAt, &timing.ReceivedAt, &timing.AppliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		timings = append(timings, timing)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return timings, nil
+}
+
+func (s *Storage) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	const op = "storage.sqlite.GetAllOrders"
+	query := `SELECT order_id, user_id, order_status, is_final, updated_at, created_at FROM orders`
+
+	rows, err := s.querier(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orders []model.Order
+	for rows.Next() {
+		var order model.Order
+		err := rows.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.IsFinal, &order.UpdatedAt, &order.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orders = append(orders, order)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orders, nil
+}
+
+func (s *Storage) GetOrder(ctx context.Context, orderId string) (model.Order, error) {
+	const op = "storage.sqlite.GetOrder"
+	query := `SELECT order_id, user_id, order_status, is_final, updated_at, created_at FROM orders WHERE order_id = ?`
+	row := s.querier(ctx).QueryRowContext(ctx, query, orderId)
+
+	var order model.Order
+	err := row.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.IsFinal, &order.UpdatedAt, &order.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Order{}, storage.OrderNotFound
+	} else if err != nil {
+		return model.Order{}, fmt.Errorf("%s: scan row: %w", op, err)
+	}
+
+	return order, nil
+}
+
+var timelineToColumn = map[model.Timeline]string{
+	model.TimelineUpdatedAt:  "updated_at",
+	model.TimelineReceivedAt: "received_at",
+}
+
+func (s *Storage) GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (model.OrderState, error) {
+	const op = "storage.sqlite.GetOrderAsOf"
+	column, ok := timelineToColumn[timeline]
+	if !ok {
+		return model.OrderState{}, fmt.Errorf("%s: unknown timeline %s", op, timeline)
+	}
+	query := fmt.Sprintf(`SELECT event_id, order_id, user_id, order_status, is_final, updated_at, created_at, is_in_order, received_at, applied_at, COALESCE(operator_id, ''), COALESCE(operator_reason, '') FROM order_events
+				WHERE order_id = ? AND %s <= ?`, column)
+
+	orderEvents, err := s.queryOrderEvents(ctx, op, query, orderId, asOf.UTC())
+	if err != nil {
+		return model.OrderState{}, err
+	}
+
+	state, ok := ordering.StateAsOf(orderEvents, asOf.UTC(), timeline)
+	if !ok {
+		return model.OrderState{}, storage.OrderNotFound
+	}
+
+	return state, nil
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, orderId string) error {
+	const op = "storage.sqlite.DeleteOrder"
+
+	query := `DELETE FROM orders WHERE order_id = ?`
+	_, err := s.querier(ctx).ExecContext(ctx, query, orderId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteOrderEvent(ctx context.Context, eventId string) error {
+	const op = "storage.sqlite.DeleteOrderEvent"
+
+	query := `DELETE FROM order_events WHERE event_id = ?`
+	result, err := s.querier(ctx).ExecContext(ctx, query, eventId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: rows affected: %w", op, err)
+	} else if deleted == 0 {
+		return fmt.Errorf("%s: %w", op, storage.EventNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) error {
+	const op = "storage.sqlite.InsertAuditEntry"
+
+	query := `INSERT INTO audit_log (order_id, event_id, action, operator_id, reason, details, created_at)
+			  VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?)`
+	_, err := s.querier(ctx).ExecContext(ctx, query, entry.OrderID, entry.EventID, entry.Action, entry.OperatorID, entry.Reason, entry.Details, entry.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetAuditEntries(ctx context.Context, orderId string) ([]model.AuditEntry, error) {
+	const op = "storage.sqlite.GetAuditEntries"
+	query := `SELECT id, order_id, COALESCE(event_id, ''), action, operator_id, reason, details, created_at FROM audit_log
+				WHERE order_id = ? ORDER BY id`
+
+	rows, err := s.querier(ctx).QueryContext(ctx, query, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var entry model.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.OrderID, &entry.EventID, &entry.Action, &entry.OperatorID, &entry.Reason, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return entries, nil
+}
+
+func (s *Storage) DeleteAllFromOrderEvents(ctx context.Context) error {
+	const op = "storage.sqlite.DeleteAllFromOrderEvents"
+
+	query := `DELETE FROM order_events`
+	_, err := s.querier(ctx).ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteAllFromOrders(ctx context.Context) error {
+	const op = "storage.sqlite.DeleteAllFromOrders"
+
+	query := `DELETE FROM orders`
+	_, err := s.querier(ctx).ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) queryOrderEvents(ctx context.Context, op string, query string, args ...any) ([]model.OrderEvent, error) {
+	rows, err := s.querier(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var orderEvents []model.OrderEvent
+	for rows.Next() {
+		var orderEvent model.OrderEvent
+		err := rows.Scan(&orderEvent.EventID, &orderEvent.OrderID, &orderEvent.UserID, &orderEvent.OrderStatus, &orderEvent.IsFinal, &orderEvent.UpdatedAt, &orderEvent.CreatedAt, &orderEvent.InOrder, &orderEvent.ReceivedAt, &orderEvent.AppliedAt, &orderEvent.OperatorID, &orderEvent.OperatorReason)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan row: %w", op, err)
+		}
+		orderEvents = append(orderEvents, orderEvent)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("%s: iterating over rows: %w", op, rows.Err())
+	}
+
+	return orderEvents, nil
+}
+
+// receivedAt defaults received_at to now like the column default does. Times are kept in UTC since SQLite
+// compares them as text.
+func receivedAt(orderEvent model.OrderEvent) time.Time {
+	if orderEvent.ReceivedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return orderEvent.ReceivedAt.UTC()
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Storage) PoolStats() model.PoolStats {
+	stats := s.db.Stats()
+	return model.PoolStats{
+		MaxConns:       int32(stats.MaxOpenConnections),
+		TotalConns:     int32(stats.OpenConnections),
+		AcquiredConns:  int32(stats.InUse),
+		IdleConns:      int32(stats.Idle),
+		WaitCount:      stats.WaitCount,
+		WaitDurationMs: stats.WaitDuration.Milliseconds(),
+	}
+}
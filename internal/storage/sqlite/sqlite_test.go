@@ -0,0 +1,220 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/migration"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/storage"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newStorage(t *testing.T) *Storage {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migration.New(slog.New(handler.NewNoOpHandler()), config.DriverSqlite, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return New(db)
+}
+
+func orderEvent(eventId string, status model.OrderStatus) model.OrderEvent {
+	return model.OrderEvent{
+		EventID: eventId,
+		Order:   model.Order{OrderID: "order", UserID: "user", OrderStatus: status},
+	}
+}
+
+func TestStorage_RunInTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, orderEvent("1", model.StatusCoolOrderCreated)); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err := s.RunInTransaction(ctx, func(ctx context.Context) error {
+		inOrder := orderEvent("1", model.StatusCoolOrderCreated)
+		inOrder.InOrder = true
+		if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, inOrder, orderEvent("2", model.StatusSbuVerificationPending)); err != nil {
+			return err
+		}
+		if err := s.InsertOrUpdateOrder(ctx, inOrder.Order); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected %v but got %v", failure, err)
+	}
+
+	events, err := s.GetAllEventsByOrderId(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].InOrder {
+		t.Errorf("expected only the initial event not in order but got %+v", events)
+	}
+	if _, err := s.GetOrder(ctx, "order"); !errors.Is(err, storage.OrderNotFound) {
+		t.Errorf("expected order to be rolled back but got %v", err)
+	}
+}
+
+func TestStorage_SaveOrderEventRejectsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	if err := s.SaveOrderEvent(ctx, orderEvent("1", model.StatusCoolOrderCreated)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveOrderEvent(ctx, orderEvent("1", model.StatusCoolOrderCreated)); !errors.Is(err, storage.EventExists) {
+		t.Errorf("expected %v but got %v", storage.EventExists, err)
+	}
+}
+
+func TestStorage_DeadLetterOrderEventsKeepsInOrderEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	receivedAt := time.Date(2024, 7, 1, 12, 0, 0, 123456789, time.FixedZone("EEST", 3*60*60))
+	inOrder := orderEvent("1", model.StatusCoolOrderCreated)
+	inOrder.InOrder = true
+	inOrder.ReceivedAt = receivedAt
+	inOrder.AppliedAt = &receivedAt
+	buffered := orderEvent("2", model.StatusChinazes)
+	buffered.ReceivedAt = receivedAt
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, inOrder, buffered); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := s.DeadLetterOrderEvents(ctx, "expired", "1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Errorf("expected 1 event to be dead lettered but got %d", moved)
+	}
+
+	events, err := s.GetAllEventsByOrderId(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].EventID != "1" {
+		t.Fatalf("expected only the in order event to be kept but got %+v", events)
+	}
+	if !events[0].ReceivedAt.Equal(receivedAt) || events[0].AppliedAt == nil || !events[0].AppliedAt.Equal(receivedAt) {
+		t.Errorf("expected received_at and applied_at %v but got %v and %v", receivedAt, events[0].ReceivedAt, events[0].AppliedAt)
+	}
+}
+
+func TestStorage_DeadLetterOrderEventsAgain(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	buffered := orderEvent("1", model.StatusChinazes)
+
+	// the payment system delivers the event again after it was dead-lettered and it expires once more
+	for _, reason := range []string{"expired", "expired again"} {
+		if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, buffered); err != nil {
+			t.Fatal(err)
+		}
+		moved, err := s.DeadLetterOrderEvents(ctx, reason, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 1 {
+			t.Errorf("expected 1 event to be dead lettered but got %d", moved)
+		}
+	}
+
+	var count int
+	var reason string
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), MAX(reason) FROM dead_letter_order_events WHERE event_id = '1'`).Scan(&count, &reason); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || reason != "expired again" {
+		t.Errorf("expected a single dead letter with the latest reason but got %d with %q", count, reason)
+	}
+}
+
+func TestStorage_DeleteOrderEventKeepsOperatorEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	forced := orderEvent("2", model.StatusConfirmedByMayor)
+	forced.OperatorID = "support"
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, orderEvent("1", model.StatusCoolOrderCreated), forced); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteOrderEvent(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteOrderEvent(ctx, "1"); !errors.Is(err, storage.EventNotFound) {
+		t.Errorf("expected event not found but got %v", err)
+	}
+
+	events, err := s.GetAllEventsByOrderId(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].OperatorID != "support" {
+		t.Errorf("expected only the operator event to remain but got %+v", events)
+	}
+}
+
+func TestStorage_GetEventTimingsSinceSkipsOperatorEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	receivedAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	received := orderEvent("1", model.StatusCoolOrderCreated)
+	received.ReceivedAt = receivedAt
+	forced := orderEvent("2", model.StatusConfirmedByMayor)
+	forced.ReceivedAt = receivedAt
+	forced.OperatorID = "support"
+	if err := s.InsertOrderEventsOrUpdateIsInOrder(ctx, received, forced); err != nil {
+		t.Fatal(err)
+	}
+
+	timings, err := s.GetEventTimingsSince(ctx, receivedAt.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timings) != 1 {
+		t.Errorf("expected only the received event to be timed but got %+v", timings)
+	}
+}
+
+func TestStorage_GetAuditEntries(t *testing.T) {
+	ctx := context.Background()
+	s := newStorage(t)
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []model.AuditEntry{
+		{OrderID: "order", EventID: "1", Action: model.AuditActionForceStatus, OperatorID: "support", Reason: "stuck", Details: "a -> b", CreatedAt: createdAt},
+		{OrderID: "other", Action: model.AuditActionReorder, OperatorID: "support", Reason: "bug", CreatedAt: createdAt},
+		{OrderID: "order", Action: model.AuditActionReorder, OperatorID: "support", Reason: "bug", CreatedAt: createdAt.Add(time.Minute)},
+	}
+	for _, entry := range entries {
+		if err := s.InsertAuditEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.GetAuditEntries(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[0].ID, entries[2].ID = 1, 3
+	if len(got) != 2 || got[0] != entries[0] || got[1] != entries[2] {
+		t.Errorf("expected entries %+v and %+v but got %+v", entries[0], entries[2], got)
+	}
+}
@@ -3,5 +3,8 @@ package storage
 import "errors"
 
 var (
-	EmailExists = errors.New("email exists")
+	EmailExists   = errors.New("email exists")
+	EventExists   = errors.New("event exists")
+	EventNotFound = errors.New("event not found")
+	OrderNotFound = errors.New("order not found")
 )
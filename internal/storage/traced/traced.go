@@ -0,0 +1,217 @@
+package traced
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"order-event-processor/internal/admin"
+	"order-event-processor/internal/broadcaster"
+	"order-event-processor/internal/buffer"
+	"order-event-processor/internal/handler"
+	"order-event-processor/internal/health"
+	"order-event-processor/internal/model"
+	"order-event-processor/internal/projection"
+	"order-event-processor/internal/stats"
+	"order-event-processor/internal/tracing"
+	"time"
+)
+
+// Wrapped is the storage Storage decorates, it has the methods of app.Storage.
+type Wrapped interface {
+	handler.OrderEventRepository
+	admin.Storage
+	handler.OrdersFinder
+	health.Pinger
+	broadcaster.FromDbEventProducerStorage
+	buffer.Storage
+	projection.Storage
+	projection.ReconcilerStorage
+	stats.Storage
+}
+
+var _ Wrapped = (*Storage)(nil)
+
+var tracer = otel.Tracer("order-event-processor/internal/storage/traced")
+
+// Storage records a span for every call of the wrapped storage, calls made in RunInTransaction
+// become children of the transaction span.
+type Storage struct {
+	storage Wrapped
+}
+
+func New(storage Wrapped) *Storage {
+	return &Storage{
+		storage: storage,
+	}
+}
+
+func (s *Storage) start(ctx context.Context, method string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "storage."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *Storage) RunInTransaction(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	ctx, span := s.start(ctx, "RunInTransaction")
+	defer func() { end(span, err) }()
+	return s.storage.RunInTransaction(ctx, run)
+}
+
+// AcquireLock is traced separately from the queries, its span shows how long the order lock was contended.
+func (s *Storage) AcquireLock(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "AcquireLock", tracing.OrderID(id))
+	defer func() { end(span, err) }()
+	return s.storage.AcquireLock(ctx, id)
+}
+
+func (s *Storage) SaveOrderEvent(ctx context.Context, event model.OrderEvent) (err error) {
+	ctx, span := s.start(ctx, "SaveOrderEvent", tracing.OrderID(event.OrderID), tracing.EventID(event.EventID))
+	defer func() { end(span, err) }()
+	return s.storage.SaveOrderEvent(ctx, event)
+}
+
+func (s *Storage) InsertOrderEventsOrUpdateIsInOrder(ctx context.Context, events ...model.OrderEvent) (err error) {
+	ctx, span := s.start(ctx, "InsertOrderEventsOrUpdateIsInOrder", eventsAttributes(events)...)
+	defer func() { end(span, err) }()
+	return s.storage.InsertOrderEventsOrUpdateIsInOrder(ctx, events...)
+}
+
+func (s *Storage) UpdateOrderEventsIsInOrderAndIsFinal(ctx context.Context, events ...model.OrderEvent) (err error) {
+	ctx, span := s.start(ctx, "UpdateOrderEventsIsInOrderAndIsFinal", eventsAttributes(events)...)
+	defer func() { end(span, err) }()
+	return s.storage.UpdateOrderEventsIsInOrderAndIsFinal(ctx, events...)
+}
+
+func (s *Storage) UpdateOrderEventFinalStatus(ctx context.Context, eventId string) (err error) {
+	ctx, span := s.start(ctx, "UpdateOrderEventFinalStatus", tracing.EventID(eventId))
+	defer func() { end(span, err) }()
+	return s.storage.UpdateOrderEventFinalStatus(ctx, eventId)
+}
+
+func (s *Storage) DeadLetterOrderEvents(ctx context.Context, reason string, eventIds ...string) (count int64, err error) {
+	ctx, span := s.start(ctx, "DeadLetterOrderEvents", attribute.Int("events", len(eventIds)))
+	defer func() { end(span, err) }()
+	return s.storage.DeadLetterOrderEvents(ctx, reason, eventIds...)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdFinalAndInOrder(ctx context.Context, orderId string) (exists bool, err error) {
+	ctx, span := s.start(ctx, "ExistsOrderEventForOrderIdFinalAndInOrder", tracing.OrderID(orderId))
+	defer func() { end(span, err) }()
+	return s.storage.ExistsOrderEventForOrderIdFinalAndInOrder(ctx, orderId)
+}
+
+func (s *Storage) ExistsOrderEventWithEventId(ctx context.Context, eventId string) (exists bool, err error) {
+	ctx, span := s.start(ctx, "ExistsOrderEventWithEventId", tracing.EventID(eventId))
+	defer func() { end(span, err) }()
+	return s.storage.ExistsOrderEventWithEventId(ctx, eventId)
+}
+
+func (s *Storage) ExistsOrderEventForOrderIdWithStatus(ctx context.Context, orderId string, orderStatus model.OrderStatus) (exists bool, err error) {
+	ctx, span := s.start(ctx, "ExistsOrderEventForOrderIdWithStatus", tracing.OrderID(orderId), attribute.String("order_status", string(orderStatus)))
+	defer func() { end(span, err) }()
+	return s.storage.ExistsOrderEventForOrderIdWithStatus(ctx, orderId, orderStatus)
+}
+
+func (s *Storage) GetAllEventsByOrderId(ctx context.Context, orderId string) (events []model.OrderEvent, err error) {
+	ctx, span := s.start(ctx, "GetAllEventsByOrderId", tracing.OrderID(orderId))
+	defer func() {
+		span.SetAttributes(attribute.Int("events", len(events)))
+		end(span, err)
+	}()
+	return s.storage.GetAllEventsByOrderId(ctx, orderId)
+}
+
+func (s *Storage) GetAllInOrderEvents(ctx context.Context) (events []model.OrderEvent, err error) {
+	ctx, span := s.start(ctx, "GetAllInOrderEvents")
+	defer func() { end(span, err) }()
+	return s.storage.GetAllInOrderEvents(ctx)
+}
+
+func (s *Storage) GetEventsOfOrdersWithOutOfOrderEvents(ctx context.Context) (events []model.OrderEvent, err error) {
+	ctx, span := s.start(ctx, "GetEventsOfOrdersWithOutOfOrderEvents")
+	defer func() { end(span, err) }()
+	return s.storage.GetEventsOfOrdersWithOutOfOrderEvents(ctx)
+}
+
+func (s *Storage) GetEventTimingsSince(ctx context.Context, since time.Time) (timings []model.EventTiming, err error) {
+	ctx, span := s.start(ctx, "GetEventTimingsSince")
+	defer func() { end(span, err) }()
+	return s.storage.GetEventTimingsSince(ctx, since)
+}
+
+func (s *Storage) InsertOrUpdateOrder(ctx context.Context, order model.Order) (err error) {
+	ctx, span := s.start(ctx, "InsertOrUpdateOrder", tracing.OrderID(order.OrderID))
+	defer func() { end(span, err) }()
+	return s.storage.InsertOrUpdateOrder(ctx, order)
+}
+
+func (s *Storage) DeleteOrder(ctx context.Context, orderId string) (err error) {
+	ctx, span := s.start(ctx, "DeleteOrder", tracing.OrderID(orderId))
+	defer func() { end(span, err) }()
+	return s.storage.DeleteOrder(ctx, orderId)
+}
+
+func (s *Storage) DeleteOrderEvent(ctx context.Context, eventId string) (err error) {
+	ctx, span := s.start(ctx, "DeleteOrderEvent", tracing.EventID(eventId))
+	defer func() { end(span, err) }()
+	return s.storage.DeleteOrderEvent(ctx, eventId)
+}
+
+func (s *Storage) InsertAuditEntry(ctx context.Context, entry model.AuditEntry) (err error) {
+	ctx, span := s.start(ctx, "InsertAuditEntry", tracing.OrderID(entry.OrderID))
+	defer func() { end(span, err) }()
+	return s.storage.InsertAuditEntry(ctx, entry)
+}
+
+func (s *Storage) GetAuditEntries(ctx context.Context, orderId string) (entries []model.AuditEntry, err error) {
+	ctx, span := s.start(ctx, "GetAuditEntries", tracing.OrderID(orderId))
+	defer func() { end(span, err) }()
+	return s.storage.GetAuditEntries(ctx, orderId)
+}
+
+func (s *Storage) GetOrder(ctx context.Context, orderId string) (order model.Order, err error) {
+	ctx, span := s.start(ctx, "GetOrder", tracing.OrderID(orderId))
+	defer func() { end(span, err) }()
+	return s.storage.GetOrder(ctx, orderId)
+}
+
+func (s *Storage) GetOrderAsOf(ctx context.Context, orderId string, asOf time.Time, timeline model.Timeline) (state model.OrderState, err error) {
+	ctx, span := s.start(ctx, "GetOrderAsOf", tracing.OrderID(orderId))
+	defer func() { end(span, err) }()
+	return s.storage.GetOrderAsOf(ctx, orderId, asOf, timeline)
+}
+
+func (s *Storage) GetAllOrders(ctx context.Context) (orders []model.Order, err error) {
+	ctx, span := s.start(ctx, "GetAllOrders")
+	defer func() { end(span, err) }()
+	return s.storage.GetAllOrders(ctx)
+}
+
+func (s *Storage) GetAllOrderIds(ctx context.Context) (orderIds []string, err error) {
+	ctx, span := s.start(ctx, "GetAllOrderIds")
+	defer func() { end(span, err) }()
+	return s.storage.GetAllOrderIds(ctx)
+}
+
+func (s *Storage) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return s.storage.Ping(ctx)
+}
+
+// eventsAttributes names the order of a batch, batches never span several orders.
+func eventsAttributes(events []model.OrderEvent) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.Int("events", len(events))}
+	if len(events) > 0 {
+		attributes = append(attributes, tracing.OrderID(events[0].OrderID))
+	}
+	return attributes
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS dead_letter_order_events;
+
+ALTER TABLE order_events
+    DROP COLUMN IF EXISTS received_at;
\ No newline at end of file
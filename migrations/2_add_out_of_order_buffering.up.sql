@@ -0,0 +1,16 @@
+ALTER TABLE order_events
+    ADD COLUMN IF NOT EXISTS received_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'utc');
+
+
+CREATE TABLE IF NOT EXISTS dead_letter_order_events
+(
+    event_id         UUID PRIMARY KEY,
+    order_id         UUID         NOT NULL,
+    user_id          UUID         NOT NULL,
+    order_status     VARCHAR(255) NOT NULL,
+    updated_at       TIMESTAMP    NOT NULL,
+    created_at       TIMESTAMP    NOT NULL,
+    received_at      TIMESTAMP    NOT NULL,
+    dead_lettered_at TIMESTAMP    NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+    reason           TEXT         NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE order_events
+    DROP COLUMN IF EXISTS operator_id;
\ No newline at end of file
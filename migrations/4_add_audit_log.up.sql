@@ -0,0 +1,17 @@
+ALTER TABLE order_events
+    ADD COLUMN IF NOT EXISTS operator_id TEXT;
+
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    UUID         NOT NULL,
+    event_id    UUID,
+    action      VARCHAR(255) NOT NULL,
+    operator_id TEXT         NOT NULL,
+    reason      TEXT         NOT NULL,
+    details     TEXT         NOT NULL DEFAULT '',
+    created_at  TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_order_id_idx ON audit_log (order_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE order_events
+    DROP COLUMN IF EXISTS operator_reason;
\ No newline at end of file
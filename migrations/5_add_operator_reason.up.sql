@@ -0,0 +1,2 @@
+ALTER TABLE order_events
+    ADD COLUMN IF NOT EXISTS operator_reason TEXT;
\ No newline at end of file
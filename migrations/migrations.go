@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations, so binaries do not depend on the working directory.
+// Postgres migrations are at the root, SQLite migrations in sqlite.
+package migrations
+
+import "embed"
+
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
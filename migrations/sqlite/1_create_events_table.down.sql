@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS order_events;
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS orders
+(
+    order_id     TEXT PRIMARY KEY,
+    user_id      TEXT     NOT NULL,
+    order_status TEXT     NOT NULL,
+    is_final     BOOLEAN  NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL
+);
+
+
+CREATE TABLE IF NOT EXISTS order_events
+(
+    event_id     TEXT PRIMARY KEY,
+    order_id     TEXT     NOT NULL,
+    user_id      TEXT     NOT NULL,
+    order_status TEXT     NOT NULL,
+    is_final     BOOLEAN  NOT NULL,
+    updated_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL,
+    is_in_order  BOOLEAN  NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS order_events_order_id_idx ON order_events (order_id);
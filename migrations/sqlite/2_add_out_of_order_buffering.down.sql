@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS dead_letter_order_events;
+
+ALTER TABLE order_events
+    DROP COLUMN received_at;
\ No newline at end of file
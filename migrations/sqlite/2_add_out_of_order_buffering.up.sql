@@ -0,0 +1,16 @@
+ALTER TABLE order_events
+    ADD COLUMN received_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+
+
+CREATE TABLE IF NOT EXISTS dead_letter_order_events
+(
+    event_id         TEXT PRIMARY KEY,
+    order_id         TEXT     NOT NULL,
+    user_id          TEXT     NOT NULL,
+    order_status     TEXT     NOT NULL,
+    updated_at       DATETIME NOT NULL,
+    created_at       DATETIME NOT NULL,
+    received_at      DATETIME NOT NULL,
+    dead_lettered_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    reason           TEXT     NOT NULL
+);
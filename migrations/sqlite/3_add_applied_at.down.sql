@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS order_events_received_at_idx;
+
+ALTER TABLE order_events
+    DROP COLUMN applied_at;
\ No newline at end of file
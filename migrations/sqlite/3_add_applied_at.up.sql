@@ -0,0 +1,6 @@
+ALTER TABLE order_events
+    ADD COLUMN applied_at DATETIME;
+
+UPDATE order_events SET applied_at = received_at WHERE is_in_order = TRUE AND applied_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS order_events_received_at_idx ON order_events (received_at);
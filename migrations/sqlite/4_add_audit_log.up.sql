@@ -0,0 +1,17 @@
+ALTER TABLE order_events
+    ADD COLUMN operator_id TEXT;
+
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id    TEXT     NOT NULL,
+    event_id    TEXT,
+    action      TEXT     NOT NULL,
+    operator_id TEXT     NOT NULL,
+    reason      TEXT     NOT NULL,
+    details     TEXT     NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_order_id_idx ON audit_log (order_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE order_events
+    DROP COLUMN operator_reason;
\ No newline at end of file
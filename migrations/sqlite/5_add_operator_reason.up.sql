@@ -0,0 +1,2 @@
+ALTER TABLE order_events
+    ADD COLUMN operator_reason TEXT;
\ No newline at end of file
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestAdminTransition moves an order stuck without confirmed_by_mayor forward, the buffered chinazes event
+// follows the synthetic event and is finalized like one sent by the payment system.
+func TestAdminTransition(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, status := range []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusChinazes} {
+		event := model.OrderEvent{
+			EventID: fmt.Sprint(i + 1),
+			Order: model.Order{
+				OrderID:     "order",
+				UserID:      "user",
+				OrderStatus: status,
+				UpdatedAt:   createdAt.Add(time.Duration(i) * time.Minute),
+				CreatedAt:   createdAt,
+			},
+		}
+		if status, err := scenario.Post(target, scenario.Payload(event)); err != nil || status != http.StatusOK {
+			t.Fatalf("expected event to be accepted but got %d, %v", status, err)
+		}
+	}
+
+	stream, err := scenario.ConnectStream(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := postAdmin(t, h, "/admin/orders/order/transitions", map[string]any{"status": model.StatusConfirmedByMayor})
+	if status != http.StatusBadRequest {
+		t.Errorf("expected a change without operator and reason to be rejected but got %d", status)
+	}
+
+	status, timeline := postAdmin(t, h, "/admin/orders/order/transitions", map[string]any{
+		"status": model.StatusConfirmedByMayor, "force": true, "operator_id": "support", "reason": "mayor confirmed by phone",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected transition to be applied but got %d", status)
+	}
+	if len(timeline.InOrder) != 4 || timeline.InOrder[2].OperatorID != "support" || len(timeline.Buffered) != 0 {
+		t.Fatalf("expected forced event followed by chinazes but got %+v", timeline)
+	}
+	forcedId := timeline.InOrder[2].EventID
+
+	eventIds, err := stream.Await(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"1", "2", forcedId, "3", "3"}; !slices.Equal(eventIds, expected) {
+		t.Errorf("expected streamed events %v but got %v", expected, eventIds)
+	}
+
+	order, err := scenario.GetOrder(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusChinazes || !order.IsFinal {
+		t.Errorf("expected final chinazes order but got %+v", order)
+	}
+
+	status, _ = postAdmin(t, h, "/admin/orders/order/transitions", map[string]any{
+		"status": model.StatusFailed, "force": true, "operator_id": "support", "reason": "too late",
+	})
+	if status != http.StatusConflict {
+		t.Errorf("expected final order to be rejected but got %d", status)
+	}
+
+	resp, err := http.DefaultClient.Do(h.NewAdminRequest(t, http.MethodGet, "/admin/orders/order/audit", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var entries []model.AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].EventID != forcedId || entries[0].Action != model.AuditActionForceStatus || entries[0].Reason != "mayor confirmed by phone" {
+		t.Errorf("expected the forced transition in the audit log but got %+v", entries)
+	}
+}
+
+// TestAdminTransitionFollowsStateMachine rejects transitions model.Transitions does not allow unless forced.
+func TestAdminTransitionFollowsStateMachine(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+
+	event := model.OrderEvent{
+		EventID: "1",
+		Order: model.Order{
+			OrderID:     "order",
+			UserID:      "user",
+			OrderStatus: model.StatusCoolOrderCreated,
+			UpdatedAt:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedAt:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	if status, err := scenario.Post(h.Target(), scenario.Payload(event)); err != nil || status != http.StatusOK {
+		t.Fatalf("expected event to be accepted but got %d, %v", status, err)
+	}
+
+	tests := []struct {
+		name     string
+		status   model.OrderStatus
+		force    bool
+		expected int
+	}{
+		{"unknown status", "shipped", true, http.StatusBadRequest},
+		{"not allowed", model.StatusChinazes, false, http.StatusConflict},
+		{"allowed", model.StatusSbuVerificationPending, false, http.StatusOK},
+		{"forced", model.StatusChinazes, true, http.StatusOK},
+	}
+	for _, test := range tests {
+		status, _ := postAdmin(t, h, "/admin/orders/order/transitions", map[string]any{
+			"status": test.status, "force": test.force, "operator_id": "support", "reason": test.name,
+		})
+		if status != test.expected {
+			t.Errorf("%s: expected status %d but got %d", test.name, test.expected, status)
+		}
+	}
+
+	order, err := scenario.GetOrder(h.Target(), "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusChinazes {
+		t.Errorf("expected chinazes order but got %s", order.OrderStatus)
+	}
+}
+
+// TestAdminForcedTransitionFromChinazes moves a chinazes order to failed before it is finalized, the pending
+// finalization job must not bring chinazes back.
+func TestAdminForcedTransitionFromChinazes(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+	postStatuses(t, target, model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor, model.StatusChinazes)
+
+	status, _ := postAdmin(t, h, "/admin/orders/order/transitions", map[string]any{
+		"status": model.StatusFailed, "force": true, "operator_id": "support", "reason": "payment charged back",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected transition to be applied but got %d", status)
+	}
+
+	target.Advance(model.ChinazesFinalizationDelay)
+	if err := h.App.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	order, err := scenario.GetOrder(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusFailed || !order.IsFinal {
+		t.Errorf("expected final failed order but got %s, final %t", order.OrderStatus, order.IsFinal)
+	}
+}
+
+// TestAdminDeleteChinazesBeforeFinalization deletes a bogus chinazes event before it is finalized, the pending
+// finalization job must not restore the orders row the operator repaired.
+func TestAdminDeleteChinazesBeforeFinalization(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+	postStatuses(t, target, model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor, model.StatusChinazes)
+
+	status, timeline := sendAdmin(t, h, http.MethodDelete, "/admin/orders/order/events/"+string(model.StatusChinazes), map[string]any{
+		"operator_id": "support", "reason": "chinazes sent by mistake",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected event to be deleted but got %d", status)
+	}
+	if timeline.Status != model.StatusConfirmedByMayor {
+		t.Fatalf("expected confirmed_by_mayor order but got %+v", timeline)
+	}
+
+	target.Advance(model.ChinazesFinalizationDelay)
+	if err := h.App.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	order, err := scenario.GetOrder(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusConfirmedByMayor || order.IsFinal {
+		t.Errorf("expected confirmed_by_mayor order that is not final but got %s, final %t", order.OrderStatus, order.IsFinal)
+	}
+}
+
+// postStatuses sends one event per status to order, a minute apart.
+func postStatuses(t *testing.T, target scenario.Target, statuses ...model.OrderStatus) {
+	t.Helper()
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, status := range statuses {
+		event := model.OrderEvent{
+			EventID: string(status),
+			Order: model.Order{
+				OrderID:     "order",
+				UserID:      "user",
+				OrderStatus: status,
+				UpdatedAt:   createdAt.Add(time.Duration(i) * time.Minute),
+				CreatedAt:   createdAt,
+			},
+		}
+		if code, err := scenario.Post(target, scenario.Payload(event)); err != nil || code != http.StatusOK {
+			t.Fatalf("expected %s event to be accepted but got %d, %v", status, code, err)
+		}
+	}
+}
+
+func TestAdminEndpointsNeedToken(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+
+	tests := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"without token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer " + AdminToken + "x", http.StatusUnauthorized},
+		{"token without scheme", AdminToken, http.StatusUnauthorized},
+		{"admin token", "Bearer " + AdminToken, http.StatusOK},
+	}
+	for _, test := range tests {
+		for _, path := range []string{"/admin/status", "/admin/faults", "/admin/reconciliation"} {
+			t.Run(test.name+" "+path, func(t *testing.T) {
+				req := h.NewAdminRequest(t, http.MethodGet, path, nil)
+				req.Header.Set("Authorization", test.authorization)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != test.expected {
+					t.Errorf("expected status %d but got %d", test.expected, resp.StatusCode)
+				}
+			})
+		}
+	}
+
+	// changes are rejected before they reach the order
+	req := h.NewAdminRequest(t, http.MethodPost, "/admin/orders/order/finalize", nil)
+	req.Header.Del("Authorization")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d but got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func postAdmin(t *testing.T, h *Harness, path string, body map[string]any) (int, model.OrderTimeline) {
+	t.Helper()
+	return sendAdmin(t, h, http.MethodPost, path, body)
+}
+
+func sendAdmin(t *testing.T, h *Harness, method string, path string, body map[string]any) (int, model.OrderTimeline) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := h.NewAdminRequest(t, method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var timeline model.OrderTimeline
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&timeline); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, timeline
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"testing"
+	"time"
+)
+
+// TestFaultInsertOrUpdateOrderAfterEventsSaved fails the orders upsert after events were saved in the same
+// transaction, the webhook must fail without leaving the event behind, so the provider's retry succeeds.
+func TestFaultInsertOrUpdateOrderAfterEventsSaved(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+	setFaults(t, h, []model.StorageFault{{Method: "InsertOrUpdateOrder", Error: "connection reset", Times: 1}})
+
+	event := model.OrderEvent{
+		EventID: "event",
+		Order: model.Order{
+			OrderID:     "order",
+			UserID:      "user",
+			OrderStatus: model.StatusCoolOrderCreated,
+			UpdatedAt:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			CreatedAt:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	status, err := scenario.Post(target, scenario.Payload(event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusInternalServerError {
+		t.Errorf("expected status %d but got %d", http.StatusInternalServerError, status)
+	}
+
+	status, err = scenario.Post(target, scenario.Payload(event))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Errorf("expected retry to succeed but got %d", status)
+	}
+	order, err := scenario.GetOrder(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusCoolOrderCreated {
+		t.Errorf("expected order %s but got %s", model.StatusCoolOrderCreated, order.OrderStatus)
+	}
+}
+
+func TestFaultLockTimeout(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	setFaults(t, h, []model.StorageFault{{Method: "AcquireLock", LockTimeout: true, LatencyMs: 10}})
+
+	status, err := scenario.Post(h.Target(), map[string]any{
+		"event_id":     "event",
+		"order_id":     "order",
+		"user_id":      "user",
+		"order_status": model.StatusCoolOrderCreated,
+		"updated_at":   "2019-01-01T00:00:00Z",
+		"created_at":   "2019-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusInternalServerError {
+		t.Errorf("expected status %d but got %d", http.StatusInternalServerError, status)
+	}
+}
+
+func setFaults(t *testing.T, h *Harness, faults []model.StorageFault) {
+	t.Helper()
+	body, err := json.Marshal(faults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(h.NewAdminRequest(t, http.MethodPut, "/admin/faults", bytes.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to set faults, status %s", resp.Status)
+	}
+}
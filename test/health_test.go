@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+
+	if status := getJSON(t, h, "/healthz", nil); status != http.StatusOK {
+		t.Errorf("expected healthz status %d but got %d", http.StatusOK, status)
+	}
+
+	var readiness model.Readiness
+	if status := getJSON(t, h, "/readyz", &readiness); status != http.StatusOK || !readiness.Ready {
+		t.Errorf("expected ready but got status %d, checks %v", status, readiness.Checks)
+	}
+
+	setFaults(t, h, []model.StorageFault{{Method: "Ping", Error: "connection refused"}})
+	if status := getJSON(t, h, "/readyz", &readiness); status != http.StatusServiceUnavailable || readiness.Ready {
+		t.Errorf("expected not ready with unreachable database but got status %d", status)
+	}
+	setFaults(t, h, nil)
+
+	if err := h.App.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if status := getJSON(t, h, "/readyz", &readiness); status != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready while shutting down but got status %d", status)
+	}
+	if status := getJSON(t, h, "/healthz", nil); status != http.StatusOK {
+		t.Errorf("expected healthz status %d while shutting down but got %d", http.StatusOK, status)
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+
+	if _, err := scenario.ConnectStream(target, "streamed"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := scenario.Post(target, map[string]any{
+		"event_id":     "confirmed",
+		"order_id":     "buffered",
+		"user_id":      "user",
+		"order_status": model.StatusConfirmedByMayor,
+		"updated_at":   "2019-01-01T00:10:00Z",
+		"created_at":   "2019-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, status)
+	}
+
+	var serverStatus model.ServerStatus
+	if status := getJSON(t, h, "/admin/status", &serverStatus); status != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, status)
+	}
+	if serverStatus.Streams != (model.StreamStats{Orders: 1, Subscribers: 1}) {
+		t.Errorf("expected one subscriber but got %+v", serverStatus.Streams)
+	}
+	if serverStatus.Scheduler.BufferedOrders != 1 || serverStatus.Scheduler.BufferedEvents != 1 {
+		t.Errorf("expected one buffered event but got %+v", serverStatus.Scheduler)
+	}
+	if !serverStatus.Readiness.Ready {
+		t.Errorf("expected ready but got %v", serverStatus.Readiness.Checks)
+	}
+	if serverStatus.Pool != nil {
+		t.Errorf("expected no pool stats for in-memory storage but got %+v", serverStatus.Pool)
+	}
+}
+
+// getJSON decodes the response body into v unless v is nil and returns the status code.
+func getJSON(t *testing.T, h *Harness, path string, v any) int {
+	t.Helper()
+	// probes ignore the admin token, /admin/status needs it
+	resp, err := http.DefaultClient.Do(h.NewAdminRequest(t, http.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
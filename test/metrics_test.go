@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"strings"
+	"testing"
+)
+
+// TestMetrics only checks series are exported, metrics are shared by the harnesses of parallel tests.
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+
+	event := map[string]any{
+		"event_id":     "metrics-created",
+		"order_id":     "metrics",
+		"user_id":      "user",
+		"order_status": model.StatusCoolOrderCreated,
+		"updated_at":   "2019-01-01T00:00:00Z",
+		"created_at":   "2019-01-01T00:00:00Z",
+	}
+	for _, expected := range []int{http.StatusOK, http.StatusConflict} {
+		status, err := scenario.Post(target, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != expected {
+			t.Fatalf("expected status %d but got %d", expected, status)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("%s/metrics", h.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, series := range []string{
+		`webhooks_total{code="200",reason="applied"} `,
+		`webhooks_total{code="409",reason="duplicate"} `,
+		`webhook_handle_duration_seconds_bucket{reason="applied",le="+Inf"} `,
+		`order_lock_wait_seconds_count{job="webhook"} `,
+		"order_event_subscribers ",
+		"order_event_broadcasts_total ",
+		"orders_with_buffered_events ",
+		"order_projection_mismatches ",
+		"order_projection_repairs_total ",
+	} {
+		if !strings.Contains(string(body), "\n"+series) {
+			t.Errorf("expected series %s in metrics", series)
+		}
+	}
+}
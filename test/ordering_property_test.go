@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"slices"
+	"testing"
+	"time"
+)
+
+const lifecycleIterations = 100
+
+// TestOrderingProperties delivers generated order lifecycles shuffled, with duplicates and delays, and checks that
+// streamed events follow model.Transitions, nothing is streamed after a final event, duplicates never change state
+// and the final projection does not depend on arrival order.
+func TestOrderingProperties(t *testing.T) {
+	for seed := int64(0); seed < lifecycleIterations; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			t.Parallel()
+			random := rand.New(rand.NewSource(seed))
+			lifecycle := scenario.GenerateLifecycle(random, "order", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			var projections []model.OrderState
+			for i := 0; i < 2; i++ {
+				projections = append(projections, deliver(t, random, lifecycle))
+			}
+			if t.Failed() {
+				t.Logf("lifecycle %v", statusesOf(lifecycle))
+				return
+			}
+
+			last := lifecycle[len(lifecycle)-1]
+			expectedFinal := model.StatusToIsFinal[last.OrderStatus] || last.OrderStatus == model.StatusChinazes
+			for _, projection := range projections {
+				if projection.OrderStatus != last.OrderStatus || projection.IsFinal != expectedFinal {
+					t.Errorf("lifecycle %v: expected projection %s, final %t but got %s, final %t",
+						statusesOf(lifecycle), last.OrderStatus, expectedFinal, projection.OrderStatus, projection.IsFinal)
+				}
+			}
+		})
+	}
+}
+
+// deliver posts the lifecycle shuffled, with duplicates and short delays, to a new harness and checks the stream.
+// The clock is advanced only after the last event, so chinazes is finalized after every event was delivered.
+func deliver(t *testing.T, random *rand.Rand, lifecycle []model.OrderEvent) model.OrderState {
+	deliveries := slices.Clone(lifecycle)
+	for duplicates := random.Intn(len(lifecycle) + 1); duplicates > 0; duplicates-- {
+		deliveries = append(deliveries, lifecycle[random.Intn(len(lifecycle))])
+	}
+	random.Shuffle(len(deliveries), func(i, j int) {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	})
+
+	target := NewHarness(t, HarnessConfig{}).Target()
+	orderId := lifecycle[0].OrderID
+	stream, err := scenario.ConnectStream(target, orderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToStatus := make(map[string]model.OrderStatus)
+	for _, event := range lifecycle {
+		idToStatus[event.EventID] = event.OrderStatus
+	}
+	stored := make(map[string]bool)
+	for _, event := range deliveries {
+		if random.Intn(3) == 0 {
+			time.Sleep(time.Duration(1+random.Intn(3)) * time.Millisecond)
+		}
+
+		var before model.OrderState
+		if stored[event.EventID] {
+			before = projectionOf(t, target, orderId)
+		}
+		status, err := scenario.Post(target, scenario.Payload(event))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case stored[event.EventID]:
+			if status != http.StatusConflict {
+				t.Errorf("expected duplicate %s to be rejected with %d but got %d", event.EventID, http.StatusConflict, status)
+			}
+			if after := projectionOf(t, target, orderId); after != before {
+				t.Errorf("duplicate %s changed the order from %+v to %+v", event.EventID, before, after)
+			}
+		case status == http.StatusOK:
+			stored[event.EventID] = true
+		case status == http.StatusGone:
+			// an event is rejected only when a final status was applied without it
+			if current := projectionOf(t, target, orderId); !model.StatusToIsFinal[current.OrderStatus] {
+				t.Errorf("event %s was rejected although the order is %s", event.EventID, current.OrderStatus)
+			}
+		default:
+			t.Errorf("unexpected status %d for %s", status, event.EventID)
+		}
+	}
+
+	streamed, err := stream.Await(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStream(t, streamed, idToStatus)
+
+	return projectionOf(t, target, orderId)
+}
+
+// projectionOf returns the zero state while the order has no projection, it has none until its first event is in order.
+func projectionOf(t *testing.T, target scenario.Target, orderId string) model.OrderState {
+	t.Helper()
+	projection, err := scenario.GetOrder(target, orderId)
+	if err != nil && !errors.Is(err, scenario.ErrOrderNotFound) {
+		t.Fatal(err)
+	}
+	return projection
+}
+
+// checkStream verifies streamed events follow model.Transitions and nothing follows a final event,
+// the only repeated event is chinazes becoming final at the end of the stream.
+func checkStream(t *testing.T, streamed []string, idToStatus map[string]model.OrderStatus) {
+	t.Helper()
+	current := model.StatusInitial
+	final := false
+	for i, eventId := range streamed {
+		status := idToStatus[eventId]
+		if final {
+			t.Errorf("event %s streamed after a final event in %v", eventId, streamed)
+			return
+		}
+		if i > 0 && streamed[i-1] == eventId {
+			if status != model.StatusChinazes || i != len(streamed)-1 {
+				t.Errorf("event %s streamed twice in %v", eventId, streamed)
+			}
+			final = true
+			continue
+		}
+		if !slices.Contains(model.Transitions[current], status) {
+			t.Errorf("streamed transition from %s to %s is not allowed in %v", current, status, streamed)
+			return
+		}
+		current = status
+		final = model.StatusToIsFinal[status]
+	}
+	if current == model.StatusChinazes && !final {
+		t.Errorf("chinazes was not streamed as final in %v", streamed)
+	}
+}
+
+func statusesOf(events []model.OrderEvent) []model.OrderStatus {
+	statuses := make([]model.OrderStatus, 0, len(events))
+	for _, event := range events {
+		statuses = append(statuses, event.OrderStatus)
+	}
+	return statuses
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"log/slog"
+	"order-event-processor/internal/app"
+	"order-event-processor/internal/config"
+	"order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/migration"
+	"order-event-processor/internal/storage/postgresql"
+	"strings"
+	"testing"
+)
+
+// newPostgresStorage migrates a new schema of the database at url and returns a storage using it, so harnesses
+// running in parallel with the same order ids do not see each other. The schema is dropped when the test ends.
+func newPostgresStorage(t *testing.T, url string) app.Storage {
+	t.Helper()
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("unable to create connection pool: %v", err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := "harness_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("unable to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA %s CASCADE", schema)); err != nil {
+			t.Errorf("unable to drop schema %s: %v", schema, err)
+		}
+	})
+
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatalf("unable to parse %s: %v", url, err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["search_path"] = schema
+	dbpool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatalf("unable to create connection pool: %v", err)
+	}
+	t.Cleanup(dbpool.Close)
+
+	migrator, err := migration.New(slog.New(handler.NewNoOpHandler()), config.DriverPostgres, stdlib.OpenDBFromPool(dbpool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("unable to apply migrations: %v", err)
+	}
+	return postgresql.New(dbpool)
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/config"
+	"order-event-processor/test/scenario"
+	"testing"
+	"time"
+)
+
+func TestReloadAppliesStreamTimeout(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	fakeClock := h.Clock.(*clock.Fake)
+
+	errInvalid := errors.New("invalid config")
+	if err := h.App.Reload(func() (*config.Config, error) { return nil, errInvalid }); !errors.Is(err, errInvalid) {
+		t.Fatalf("expected the load error but got %v", err)
+	}
+
+	err := h.App.Reload(func() (*config.Config, error) {
+		return &config.Config{
+			Env:        config.EnvProd,
+			Stream:     config.Stream{Timeout: 5 * time.Second},
+			Projection: config.Projection{BatchSize: 100, Workers: 4},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := scenario.ConnectStream(h.Target(), "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(5 * time.Second)
+	// without Advance the stream only ends if the reloaded timeout fired
+	if _, err := stream.Await(scenario.Target{URL: h.URL}); err != nil {
+		t.Fatalf("expected stream to time out after the reloaded timeout: %v", err)
+	}
+
+	status, err := h.App.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Env != "" {
+		t.Errorf("env needs a restart but was reloaded to %q", status.Env)
+	}
+}
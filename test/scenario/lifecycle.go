@@ -0,0 +1,46 @@
+package scenario
+
+import (
+	"fmt"
+	"math/rand"
+	"order-event-processor/internal/model"
+	"time"
+)
+
+// GenerateLifecycle walks model.Transitions from model.StatusInitial choosing next statuses at random,
+// it stops at a status without transitions or, with some probability, earlier. Event ids are derived from orderId.
+func GenerateLifecycle(random *rand.Rand, orderId string, createdAt time.Time) []model.OrderEvent {
+	updatedAt := createdAt
+	var lifecycle []model.OrderEvent
+	status := model.StatusInitial
+	for {
+		next := model.Transitions[status]
+		if len(next) == 0 || (len(lifecycle) > 0 && random.Intn(6) == 0) {
+			return lifecycle
+		}
+		status = next[random.Intn(len(next))]
+		lifecycle = append(lifecycle, model.OrderEvent{
+			EventID: fmt.Sprintf("%s-%d", orderId, len(lifecycle)),
+			Order: model.Order{
+				OrderID:     orderId,
+				UserID:      "user",
+				OrderStatus: status,
+				UpdatedAt:   updatedAt,
+				CreatedAt:   createdAt,
+			},
+		})
+		updatedAt = updatedAt.Add(time.Duration(1+random.Intn(60)) * time.Minute)
+	}
+}
+
+// Payload returns event as the payment system sends it to the webhook.
+func Payload(event model.OrderEvent) map[string]any {
+	return map[string]any{
+		"event_id":     event.EventID,
+		"order_id":     event.OrderID,
+		"user_id":      event.UserID,
+		"order_status": event.OrderStatus,
+		"updated_at":   event.UpdatedAt,
+		"created_at":   event.CreatedAt,
+	}
+}
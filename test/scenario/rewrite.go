@@ -0,0 +1,55 @@
+package scenario
+
+import (
+	"github.com/google/uuid"
+)
+
+// WithRandomIds returns a copy of s where the order id and event ids are replaced by new random ids,
+// consistently across steps and expectations, so copies of a scenario run concurrently without sharing orders.
+func (s Scenario) WithRandomIds() Scenario {
+	ids := make(map[string]string)
+	rewrite := func(id string) string {
+		if id == "" {
+			return id
+		}
+		if rewritten, ok := ids[id]; ok {
+			return rewritten
+		}
+		ids[id] = uuid.NewString()
+		return ids[id]
+	}
+
+	rewritten := s
+	rewritten.OrderID = rewrite(s.OrderID)
+	rewritten.Steps = make([]Step, len(s.Steps))
+	for i, step := range s.Steps {
+		if step.Post != nil {
+			post := make(map[string]any, len(step.Post))
+			for key, value := range step.Post {
+				if id, ok := value.(string); ok && (key == "order_id" || key == "event_id") {
+					value = rewrite(id)
+				}
+				post[key] = value
+			}
+			step.Post = post
+		}
+		rewritten.Steps[i] = step
+	}
+	if s.Expect.Stream != nil {
+		rewritten.Expect.Stream = make([]string, len(s.Expect.Stream))
+		for i, eventId := range s.Expect.Stream {
+			rewritten.Expect.Stream[i] = rewrite(eventId)
+		}
+	}
+	return rewritten
+}
+
+// NeedsFakeClock reports whether s has advance_clock steps, which only run against an in-process server.
+func (s Scenario) NeedsFakeClock() bool {
+	for _, step := range s.Steps {
+		if step.AdvanceClock > 0 {
+			return true
+		}
+	}
+	return false
+}
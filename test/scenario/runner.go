@@ -0,0 +1,235 @@
+package scenario
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-event-processor/internal/model"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	subscribeTimeout = 10 * time.Second
+	// streamTimeout exceeds the one minute a stream stays open without events
+	streamTimeout = 2 * time.Minute
+	orderTimeout  = 5 * time.Second
+)
+
+// Target is the server a scenario runs against.
+type Target struct {
+	URL string
+	// Advance moves the server clock forward, it is nil when the server runs with the real clock,
+	// then advance_clock steps fail and streams are awaited in real time.
+	Advance func(d time.Duration)
+}
+
+// Reporter receives failed expectations, *testing.T implements it.
+type Reporter interface {
+	Errorf(format string, args ...any)
+}
+
+// Run executes the steps of s one by one and checks the expectations afterwards.
+func Run(target Target, s Scenario, reporter Reporter) {
+	var stream *EventStream
+	for i, step := range s.Steps {
+		switch {
+		case step.Post != nil:
+			status, err := Post(target, step.Post)
+			if err != nil {
+				reporter.Errorf("step %d: %v", i+1, err)
+				continue
+			}
+			expected := step.Status
+			if expected == 0 {
+				expected = http.StatusOK
+			}
+			if status != expected {
+				reporter.Errorf("step %d: expected status %d but got %d", i+1, expected, status)
+			}
+		case step.Wait > 0:
+			time.Sleep(step.Wait)
+		case step.AdvanceClock > 0:
+			if target.Advance == nil {
+				reporter.Errorf("step %d: advance_clock needs a server with a fake clock", i+1)
+				return
+			}
+			target.Advance(step.AdvanceClock)
+		case step.ConnectStream:
+			if stream != nil {
+				reporter.Errorf("step %d: stream is already connected", i+1)
+				continue
+			}
+			var err error
+			stream, err = ConnectStream(target, s.OrderID)
+			if err != nil {
+				reporter.Errorf("step %d: %v", i+1, err)
+				return
+			}
+		}
+	}
+
+	if stream != nil {
+		eventIds, err := stream.Await(target)
+		if err != nil {
+			reporter.Errorf("%v", err)
+		} else if s.Expect.Stream != nil && !slices.Equal(eventIds, s.Expect.Stream) {
+			reporter.Errorf("expected streamed events %v but got %v", s.Expect.Stream, eventIds)
+		}
+	} else if s.Expect.Stream != nil {
+		reporter.Errorf("stream is expected but no step connects it")
+	}
+
+	if s.Expect.Order != nil {
+		checkOrder(target, s.OrderID, *s.Expect.Order, reporter)
+	}
+}
+
+// Post sends event to the webhook and returns the response status.
+func Post(target Target, event map[string]any) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.Post(fmt.Sprintf("%s/webhooks/payments/orders", target.URL), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// EventStream collects ids of events streamed for an order until the server closes the stream.
+type EventStream struct {
+	mutex    sync.Mutex
+	eventIds []string
+	err      error
+	done     chan struct{}
+}
+
+// connectStream returns once the server subscribed the stream, so events posted afterwards are streamed.
+func ConnectStream(target Target, orderId string) (*EventStream, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/orders/%s/events", target.URL, orderId))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid stream response status %s", resp.Status)
+	}
+
+	stream := &EventStream{done: make(chan struct{})}
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(stream.done)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "":
+			case line == ": subscribed":
+				close(subscribed)
+			case line == "event: shutdown":
+				stream.mutex.Lock()
+				if stream.err == nil {
+					stream.err = errors.New("stream closed by server shutdown")
+				}
+				stream.mutex.Unlock()
+				return
+			case strings.HasPrefix(line, "data: "):
+				event := model.OrderEvent{}
+				err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+				stream.mutex.Lock()
+				if err != nil && stream.err == nil {
+					stream.err = err
+				}
+				stream.eventIds = append(stream.eventIds, event.EventID)
+				stream.mutex.Unlock()
+			default:
+				stream.mutex.Lock()
+				if stream.err == nil {
+					stream.err = fmt.Errorf("invalid SSE stream line %q", line)
+				}
+				stream.mutex.Unlock()
+			}
+		}
+	}()
+
+	select {
+	case <-subscribed:
+	case <-stream.done:
+	case <-time.After(subscribeTimeout):
+		return nil, fmt.Errorf("stream was not subscribed within %s", subscribeTimeout)
+	}
+	return stream, nil
+}
+
+// Await waits for the server to close the stream, with a fake clock it moves the clock a second at a time
+// so finalization jobs and stream timeouts fire in the same order they would with the real clock.
+func (s *EventStream) Await(target Target) ([]string, error) {
+	deadline := time.After(streamTimeout)
+	for {
+		tick := time.After(time.Millisecond)
+		select {
+		case <-s.done:
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return s.eventIds, s.err
+		case <-deadline:
+			return nil, fmt.Errorf("stream was not closed within %s", streamTimeout)
+		case <-tick:
+			if target.Advance != nil {
+				target.Advance(time.Second)
+			}
+		}
+	}
+}
+
+// checkOrder polls the order since jobs triggered by the last steps may still be running.
+func checkOrder(target Target, orderId string, expected ExpectOrder, reporter Reporter) {
+	deadline := time.Now().Add(orderTimeout)
+	for {
+		actual, err := GetOrder(target, orderId)
+		if err == nil && actual.OrderStatus == expected.OrderStatus && actual.IsFinal == expected.IsFinal {
+			return
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				reporter.Errorf("failed to get order: %v", err)
+			} else {
+				reporter.Errorf("expected order %s, final %t but got %s, final %t", expected.OrderStatus, expected.IsFinal, actual.OrderStatus, actual.IsFinal)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// GetOrder returns the current projection of the order or ErrOrderNotFound when it has none yet.
+func GetOrder(target Target, orderId string) (model.OrderState, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/orders/%s", target.URL, orderId))
+	if err != nil {
+		return model.OrderState{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return model.OrderState{}, ErrOrderNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return model.OrderState{}, fmt.Errorf("invalid response status %s", resp.Status)
+	}
+	var order model.OrderState
+	err = json.NewDecoder(resp.Body).Decode(&order)
+	return order, err
+}
@@ -0,0 +1,106 @@
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"order-event-processor/internal/model"
+	"path"
+	"strings"
+	"time"
+)
+
+// Scenario is a sequence of steps run against the server followed by expectations
+// about the events streamed for OrderID and the final state of the order.
+type Scenario struct {
+	Name    string `yaml:"name"`
+	OrderID string `yaml:"order_id"`
+	Steps   []Step `yaml:"steps"`
+	Expect  Expect `yaml:"expect"`
+}
+
+// Step does exactly one thing, Status is the expected response status of Post and defaults to 200.
+type Step struct {
+	Post          map[string]any `yaml:"post"`
+	Status        int            `yaml:"status"`
+	Wait          time.Duration  `yaml:"wait"`
+	AdvanceClock  time.Duration  `yaml:"advance_clock"`
+	ConnectStream bool           `yaml:"connect_stream"`
+}
+
+type Expect struct {
+	// Stream lists event ids in the order they are streamed, a final event is listed again once it becomes final.
+	Stream []string     `yaml:"stream"`
+	Order  *ExpectOrder `yaml:"order"`
+}
+
+type ExpectOrder struct {
+	OrderStatus model.OrderStatus `yaml:"order_status"`
+	IsFinal     bool              `yaml:"is_final"`
+}
+
+// Parse reads a scenario in YAML, JSON is accepted as well since it is valid YAML.
+func Parse(name string, data []byte) (Scenario, error) {
+	var s Scenario
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil {
+		return Scenario{}, fmt.Errorf("scenario %s: %w", name, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	if err := s.validate(); err != nil {
+		return Scenario{}, fmt.Errorf("scenario %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// LoadAll parses every .yaml, .yml and .json file in the root of fsys.
+func LoadAll(fsys fs.FS) ([]Scenario, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var scenarios []Scenario
+	for _, entry := range entries {
+		switch path.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		s, err := Parse(entry.Name(), data)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+func (s Scenario) validate() error {
+	if s.OrderID == "" {
+		return errors.New("order_id is required")
+	}
+	for i, step := range s.Steps {
+		actions := 0
+		for _, set := range []bool{step.Post != nil, step.Wait > 0, step.AdvanceClock > 0, step.ConnectStream} {
+			if set {
+				actions++
+			}
+		}
+		if actions != 1 {
+			return fmt.Errorf("step %d must have exactly one of post, wait, advance_clock and connect_stream", i+1)
+		}
+		if step.Status != 0 && step.Post == nil {
+			return fmt.Errorf("step %d has status without post", i+1)
+		}
+	}
+	return nil
+}
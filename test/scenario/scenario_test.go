@@ -0,0 +1,85 @@
+package scenario
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("refund.yaml", []byte(`
+order_id: order
+steps:
+  - connect_stream: true
+  - post: {event_id: event, order_id: order}
+    status: 410
+  - advance_clock: 30s
+expect:
+  stream: [event]
+  order: {order_status: chinazes, is_final: true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "refund" {
+		t.Errorf("expected name to default to file name but got %s", s.Name)
+	}
+	if len(s.Steps) != 3 || s.Steps[1].Status != 410 || s.Steps[2].AdvanceClock != 30*time.Second {
+		t.Errorf("unexpected steps %+v", s.Steps)
+	}
+	if s.Expect.Order == nil || !s.Expect.Order.IsFinal {
+		t.Errorf("unexpected order expectation %+v", s.Expect.Order)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing order id", "steps: [{wait: 1s}]"},
+		{"two actions in a step", "order_id: order\nsteps: [{wait: 1s, connect_stream: true}]"},
+		{"status without post", "order_id: order\nsteps: [{wait: 1s, status: 200}]"},
+		{"unknown field", "order_id: order\nsteps: [{sleep: 1s}]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse("invalid.yaml", []byte(test.data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestWithRandomIds(t *testing.T) {
+	s := Scenario{
+		OrderID: "order",
+		Steps: []Step{
+			{Post: map[string]any{"event_id": "first", "order_id": "order", "order_status": "cool_order_created"}},
+			{Post: map[string]any{"event_id": "second", "order_id": "order"}},
+		},
+		Expect: Expect{Stream: []string{"first", "second", "second"}},
+	}
+
+	rewritten := s.WithRandomIds()
+	if rewritten.OrderID == s.OrderID {
+		t.Error("expected order id to be rewritten")
+	}
+	for i, step := range rewritten.Steps {
+		if step.Post["order_id"] != rewritten.OrderID {
+			t.Errorf("step %d: expected order id %s but got %v", i+1, rewritten.OrderID, step.Post["order_id"])
+		}
+		if step.Post["event_id"] != rewritten.Expect.Stream[i] {
+			t.Errorf("step %d: expected event id %s but got %v", i+1, rewritten.Expect.Stream[i], step.Post["event_id"])
+		}
+	}
+	if rewritten.Steps[0].Post["order_status"] != "cool_order_created" {
+		t.Error("expected fields other than ids to be kept")
+	}
+	if rewritten.Expect.Stream[1] != rewritten.Expect.Stream[2] {
+		t.Error("expected the same id to be rewritten consistently")
+	}
+	if s.Steps[0].Post["event_id"] != "first" || s.Expect.Stream[0] != "first" {
+		t.Error("expected the original scenario to be left unchanged")
+	}
+}
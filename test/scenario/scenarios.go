@@ -2,7 +2,7 @@ package scenario
 
 import "embed"
 
-//go:embed *
+//go:embed *.yaml
 var Files embed.FS
 
 const Path = "test/scenario"
@@ -0,0 +1,19 @@
+package tests
+
+import (
+	"order-event-processor/test/scenario"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := scenario.LoadAll(scenario.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			t.Parallel()
+			scenario.Run(NewHarness(t, HarnessConfig{}).Target(), s, t)
+		})
+	}
+}
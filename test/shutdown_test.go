@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"order-event-processor/internal/clock"
+	"order-event-processor/internal/model"
+	"order-event-processor/test/scenario"
+	"testing"
+	"time"
+)
+
+func TestShutdownEndsStreamsWithTerminalFrame(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+
+	stream, err := scenario.ConnectStream(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.App.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Await(target); err == nil {
+		t.Error("expected stream to end with a shutdown frame")
+	}
+
+	// streams opened while the server drains end right away
+	late, err := scenario.ConnectStream(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := late.Await(target); err == nil {
+		t.Error("expected late stream to end with a shutdown frame")
+	}
+}
+
+func TestShutdownWaitsForChinazesFinalization(t *testing.T) {
+	t.Parallel()
+	h := NewHarness(t, HarnessConfig{})
+	target := h.Target()
+	fakeClock := h.Clock.(*clock.Fake)
+
+	createdAt := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []model.OrderStatus{model.StatusCoolOrderCreated, model.StatusSbuVerificationPending, model.StatusConfirmedByMayor, model.StatusChinazes}
+	for i, status := range statuses {
+		event := model.OrderEvent{
+			EventID: string(status),
+			Order: model.Order{
+				OrderID:     "order",
+				UserID:      "user",
+				OrderStatus: status,
+				UpdatedAt:   createdAt.Add(time.Duration(i) * time.Minute),
+				CreatedAt:   createdAt,
+			},
+		}
+		code, err := scenario.Post(target, scenario.Payload(event))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK {
+			t.Fatalf("expected status %d for %s but got %d", http.StatusOK, status, code)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.App.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected shutdown to wait for the finalization job but got %v", err)
+	}
+
+	fakeClock.Advance(model.ChinazesFinalizationDelay)
+	if err := h.App.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	order, err := scenario.GetOrder(target, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderStatus != model.StatusChinazes || !order.IsFinal {
+		t.Errorf("expected final chinazes order but got %s, final %t", order.OrderStatus, order.IsFinal)
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"order-event-processor/internal/model"
+	"testing"
+)
+
+// TestTracingContinuesProviderTrace is not parallel, it installs the global tracer provider.
+func TestTracingContinuesProviderTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	h := NewHarness(t, HarnessConfig{})
+	body, err := json.Marshal(map[string]any{
+		"event_id":     "traced-created",
+		"order_id":     "traced",
+		"user_id":      "user",
+		"order_status": model.StatusCoolOrderCreated,
+		"updated_at":   "2019-01-01T00:00:00Z",
+		"created_at":   "2019-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/webhooks/payments/orders", h.URL), bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-00f067aa0ba902b7-01", traceId))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	orderIds := make(map[string]string)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceId {
+			continue
+		}
+		orderIds[span.Name()] = ""
+		for _, attribute := range span.Attributes() {
+			if attribute.Key == "order_id" {
+				orderIds[span.Name()] = attribute.Value.AsString()
+			}
+		}
+	}
+	for _, name := range []string{
+		"POST /webhooks/payments/orders",
+		"storage.RunInTransaction",
+		"storage.AcquireLock",
+		"storage.GetAllEventsByOrderId",
+		"storage.InsertOrUpdateOrder",
+		"broadcast",
+	} {
+		orderId, ok := orderIds[name]
+		if !ok {
+			t.Errorf("expected span %s in the provider's trace", name)
+		} else if name != "storage.RunInTransaction" && orderId != "traced" {
+			t.Errorf("expected span %s to have order_id traced but got %q", name, orderId)
+		}
+	}
+}
@@ -1,172 +1,90 @@
 package tests
 
 import (
-	"bufio"
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"order-event-processor/internal/app"
+	"order-event-processor/internal/clock"
 	"order-event-processor/internal/config"
-	"order-event-processor/internal/model"
-	"order-event-processor/internal/storage/postgresql"
+	"order-event-processor/internal/lib/logger/handler"
+	"order-event-processor/internal/storage/memory"
 	"order-event-processor/test/scenario"
-	"path/filepath"
-	"sort"
-	"strconv"
-	"strings"
-	"sync"
+	"os"
 	"testing"
 	"time"
 )
 
-var url = "http://localhost:8080"
+// AdminToken is the admin.token of every harness, NewAdminRequest sends it.
+const AdminToken = "harness-admin-token"
 
-func ExecuteScenario(t *testing.T, path string, timeoutBeforeListeningStream time.Duration, expectedEventIdsInOrder []string) {
-	clearDb(t)
-	files, err := ReadScenarioDir(path)
-	if err != nil {
-		t.Fatal(err)
-	}
-	orderId := getOrderId(files[0].Content, t)
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		time.Sleep(timeoutBeforeListeningStream * time.Millisecond)
-		resp, err := http.Get(fmt.Sprintf("%s/orders/%s/events", url, orderId))
-		if err != nil {
-			fmt.Println("Error connecting to SSE stream:", err)
-			t.Error(err)
-		}
-		defer resp.Body.Close()
-
-		reader := bufio.NewReader(resp.Body)
-
-		fmt.Println("Connected to SSE stream. Listening for events...")
-
-		index := 0
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				break
-			}
-
-			line = strings.TrimSpace(line)
-
-			if len(line) == 0 {
-				continue
-			}
-			if strings.Index(line, "data: ") != 0 {
-				t.Errorf(fmt.Sprintf("Invalid SSE stream"))
-			}
-
-			event := model.OrderEvent{}
-			data := line[6:]
-			err = json.Unmarshal([]byte(data), &event)
-			if err != nil {
-				t.Error(err)
-			}
-			if expectedEventIdsInOrder[index] != event.EventID {
-				t.Error(fmt.Errorf("expected event id to be %s but got %s", expectedEventIdsInOrder[index], event.EventID))
-			}
-			index++
-		}
-		if index != len(expectedEventIdsInOrder) {
-			t.Error(fmt.Errorf("expected events count to be %d but got %d", len(expectedEventIdsInOrder), index))
-		}
-		wg.Done()
-	}()
-	for _, file := range files {
-		time.Sleep(file.Timeout * time.Millisecond)
-		resp, err := http.Post(fmt.Sprintf("%v/webhooks/payments/orders", url), "application/json", bytes.NewBuffer([]byte(file.Content)))
-		if err != nil {
-			t.Error(err)
-		}
-		if resp.Status != "200 OK" {
-			t.Error(fmt.Errorf("invalid response status %s", resp.Status))
-		}
-		err = resp.Body.Close()
-		if err != nil {
-			t.Error(err)
-		}
-	}
+// HarnessConfig selects the storage and clock a Harness runs with, zero values mean a fake clock and in-memory
+// storage, or postgres storage in a schema of its own when DATABASE_URL is set.
+type HarnessConfig struct {
+	Storage app.Storage
+	Clock   clock.Clock
+}
 
-	wg.Wait()
+// Harness serves the full router over an httptest.Server, every harness has its own storage and broadcaster,
+// so scenarios run in parallel without sharing state.
+type Harness struct {
+	URL     string
+	App     *app.App
+	Storage app.Storage
+	Clock   clock.Clock
 }
 
-func clearDb(t *testing.T) {
-	cfg := config.ReadConfig("../config/local.yaml")
-	dbpool, err := pgxpool.New(context.Background(), cfg.Datasource.Url)
-	defer dbpool.Close()
-	if err != nil {
-		t.Fatal("unable to create connection pool", "error", err)
+func NewHarness(t *testing.T, harnessConfig HarnessConfig) *Harness {
+	if harnessConfig.Storage == nil {
+		if url := os.Getenv("DATABASE_URL"); url != "" {
+			harnessConfig.Storage = newPostgresStorage(t, url)
+		} else {
+			harnessConfig.Storage = memory.New()
+		}
 	}
-	storage := postgresql.New(dbpool)
-	err = storage.DeleteAllFromOrderEvents()
-	if err != nil {
-		t.Fatal(err)
+	if harnessConfig.Clock == nil {
+		harnessConfig.Clock = clock.NewFake(time.Now())
 	}
-	err = storage.DeleteAllFromOrders()
-	if err != nil {
-		t.Fatal(err)
+
+	cfg := &config.Config{
+		Stream:     config.Stream{Timeout: time.Minute},
+		Projection: config.Projection{BatchSize: 100, Workers: 4},
+		Admin:      config.Admin{Token: AdminToken, FaultInjection: true},
 	}
-}
+	log := slog.New(handler.NewNoOpHandler())
+	application := app.New(log, cfg, harnessConfig.Storage, harnessConfig.Clock)
 
-func getOrderId(rawEvent string, t *testing.T) string {
-	event := model.OrderEvent{}
-	err := json.Unmarshal([]byte(rawEvent), &event)
-	if err != nil {
-		t.Fatal(err)
+	server := httptest.NewServer(application.Handler())
+	t.Cleanup(func() {
+		// streams left open by a failed test would keep Close waiting
+		server.CloseClientConnections()
+		server.Close()
+	})
+	return &Harness{
+		URL:     server.URL,
+		App:     application,
+		Storage: harnessConfig.Storage,
+		Clock:   harnessConfig.Clock,
 	}
-	return event.OrderID
 }
 
-type ScenarioFile struct {
-	Index    int
-	FileName string
-	Content  string
-	Timeout  time.Duration
+// Target lets scenario.Run drive the harness, including its clock when it is fake.
+func (h *Harness) Target() scenario.Target {
+	target := scenario.Target{URL: h.URL}
+	if fakeClock, ok := h.Clock.(*clock.Fake); ok {
+		target.Advance = fakeClock.Advance
+	}
+	return target
 }
 
-func ReadScenarioDir(path string) ([]ScenarioFile, error) {
-	dirs, err := scenario.Files.ReadDir(path)
+// NewAdminRequest returns a request to path of the harness carrying the admin token.
+func (h *Harness) NewAdminRequest(t *testing.T, method string, path string, body io.Reader) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, h.URL+path, body)
 	if err != nil {
-		return nil, err
-	}
-	files := make([]ScenarioFile, 0, len(dirs))
-	for _, dir := range dirs {
-		name := dir.Name()
-		fullPath := filepath.Join(path, name)
-		file, err := scenario.Files.ReadFile(fullPath)
-		if err != nil {
-			return nil, err
-		}
-		i := strings.Index(name, "_")
-		var index int
-		if i != -1 {
-			index, err = strconv.Atoi(name[:i])
-			if err != nil {
-				index = 0
-			}
-		} else {
-			index = 0
-		}
-		lastUnderscore := strings.LastIndex(name, "_")
-		lastDot := strings.LastIndex(name, ".")
-		var timeout int
-		if lastUnderscore != -1 && lastDot != -1 {
-			timeout, err = strconv.Atoi(name[lastUnderscore+1 : lastDot])
-			if err != nil {
-				timeout = 0
-			}
-		} else {
-			timeout = 0
-		}
-		files = append(files, ScenarioFile{index, name, string(file), time.Duration(timeout)})
+		t.Fatal(err)
 	}
-	sort.SliceStable(files, func(i, j int) bool {
-		return files[i].Index < files[j].Index
-	})
-	return files, nil
+	req.Header.Set("Authorization", "Bearer "+AdminToken)
+	return req
 }